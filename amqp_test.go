@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+type amqpServerOptions struct {
+	tls      bool
+	username string
+	password string
+	vhost    string
+}
+
+// newAMQPServer serves the opening and closing of AMQP 0-9-1 connections,
+// returning the server's port and tls options trusting its certificate.
+func newAMQPServer(t *testing.T, opts amqpServerOptions) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, opts.tls, func(conn net.Conn, _ *tls.Config) {
+		c := &amqpConn{conn: conn, r: bufio.NewReader(conn)}
+		closeWith := func(code uint16, text string) {
+			args := binary.BigEndian.AppendUint16(nil, code)
+			args = amqpShortString(args, text)
+			c.write(amqpConnectionClass, amqpClose, binary.BigEndian.AppendUint32(args, 0))
+		}
+
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			return
+		}
+		if !bytes.Equal(header, amqpProtocolHeader) {
+			conn.Write(amqpProtocolHeader)
+			return
+		}
+
+		// Start, with string, boolean and table properties
+		capabilities := amqpShortString(nil, "publisher_confirms")
+		capabilities = append(capabilities, 't', 1)
+		properties := amqpLongString(append(amqpShortString(nil, "product"), 'S'), "RabbitMQ")
+		properties = amqpLongString(append(amqpShortString(properties, "capabilities"), 'F'), string(capabilities))
+		properties = amqpLongString(append(amqpShortString(properties, "version"), 'S'), "3.13.0")
+		args := amqpLongString([]byte{0, 9}, string(properties))
+		args = amqpLongString(args, "AMQPLAIN PLAIN")
+		args = amqpLongString(args, "en_US")
+		c.write(amqpConnectionClass, amqpStart, args)
+
+		startOk, err := c.read()
+		if err != nil {
+			return
+		}
+		d := &amqpDecoder{b: startOk.args}
+		d.table()
+		d.shortString()
+		username, password := opts.username, opts.password
+		if username == "" {
+			username, password = "guest", "guest"
+		}
+		if d.longString() != "\x00"+username+"\x00"+password {
+			closeWith(403, "ACCESS_REFUSED - Login was refused using authentication mechanism PLAIN")
+			return
+		}
+
+		args = binary.BigEndian.AppendUint16(nil, 2047)
+		args = binary.BigEndian.AppendUint32(args, 131072)
+		c.write(amqpConnectionClass, amqpTune, binary.BigEndian.AppendUint16(args, 60))
+		if _, err := c.read(); err != nil {
+			return
+		}
+
+		open, err := c.read()
+		if err != nil {
+			return
+		}
+		vhost := (&amqpDecoder{b: open.args}).shortString()
+		if vhost != "/" && vhost != opts.vhost {
+			closeWith(530, fmt.Sprintf("NOT_ALLOWED - vhost %s not found", vhost))
+			return
+		}
+		c.write(amqpConnectionClass, amqpOpenOk, amqpShortString(nil, ""))
+
+		// The client's Connection.Close is read as an error
+		if m, err := c.read(); err != nil && m != nil {
+			c.write(amqpConnectionClass, amqpCloseOk, nil)
+		}
+	})
+}
+
+func TestAMQP(t *testing.T) {
+	cases := []struct {
+		name   string
+		scheme string
+		url    string
+		opts   amqpServerOptions
+		want   string
+	}{
+		{name: "guest", scheme: "amqp", url: "%s"},
+		{name: "credentials", scheme: "amqp", url: "monitor:secret@%s", opts: amqpServerOptions{username: "monitor", password: "secret"}},
+		{name: "wrong password", scheme: "amqp", url: "monitor:wrong@%s", opts: amqpServerOptions{username: "monitor", password: "secret"}, want: "Authentication as monitor failed: Expected Connection.Tune: Server closed the connection: 403 ACCESS_REFUSED"},
+		{name: "vhost", scheme: "amqp", url: "%s/orders", opts: amqpServerOptions{vhost: "orders"}},
+		{name: "unknown vhost", scheme: "amqp", url: "%s/billing", opts: amqpServerOptions{vhost: "orders"}, want: "Failed to open virtual host billing: Expected Connection.Open-Ok: Server closed the connection: 530 NOT_ALLOWED"},
+		{name: "tls", scheme: "amqps", url: "%s", opts: amqpServerOptions{tls: true}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port, config := newAMQPServer(t, tc.opts)
+			dest, err := NewDestination(Url{Label: "amqp", Url: fmt.Sprintf("%s://%s", tc.scheme, fmt.Sprintf(tc.url, fmt.Sprintf("127.0.0.1:%d", port))), TLS: config})
+			assertNoError(t, "NewDestination", err)
+
+			server, err := amqpConversation(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if AMQP(dest) {
+					t.Errorf("AMQP = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "amqpConversation", err)
+			if server != "RabbitMQ 3.13.0" {
+				t.Errorf("server = %q; want RabbitMQ 3.13.0", server)
+			}
+			if !AMQP(dest) {
+				t.Errorf("AMQP = false; want true")
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"log"
 	"net"
+	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -194,6 +197,9 @@ func TestWaitLoopCompletesWhenChecksSucceed(t *testing.T) {
 // Refs #16 — the production logic for the reset already merged; this test
 // locks it in so future refactors don't regress it.
 func TestMonitorWithCheckResetsConfidenceOnFailure(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
 	dest := &Destination{Label: "stub", Host: "host", Port: 1}
 
 	var sleeps []time.Duration
@@ -228,3 +234,149 @@ func TestMonitorWithCheckResetsConfidenceOnFailure(t *testing.T) {
 		t.Errorf("confidence after failure = %d; want 1", confidence)
 	}
 }
+
+// TestMonitorWithCheckUsesFailingInterval drives the monitor loop through an
+// outage with a custom schedule: while failing, checks repeat at the
+// failing_interval rather than the bottom of the confidence ramp.
+func TestMonitorWithCheckUsesFailingInterval(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	dest := &Destination{
+		Label: "stub",
+		Host:  "host",
+		Port:  1,
+		Schedule: Schedule{
+			MinInterval:     30 * time.Second,
+			MaxInterval:     2 * time.Minute,
+			FailingInterval: 5 * time.Second,
+		},
+	}
+
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	results := []bool{true, true, true, true, false, false, true}
+	want := []time.Duration{
+		60 * time.Second,
+		90 * time.Second,
+		120 * time.Second,
+		120 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+		60 * time.Second,
+	}
+
+	confidence := 1
+	for _, r := range results {
+		r := r
+		confidence = dest.monitorWithCheck(confidence, func() bool { return r }, sleep)
+	}
+
+	for i := range want {
+		if sleeps[i] != want[i] {
+			t.Errorf("sleeps[%d] = %v; want %v", i, sleeps[i], want[i])
+		}
+	}
+}
+
+// TestMonitorWithCheckEmitsStateGauge verifies that each monitor iteration
+// reports the destination's confirmed State, which only changes once the
+// failure threshold is met.
+func TestMonitorWithCheckEmitsStateGauge(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	dest := &Destination{Label: "stub", Host: "host", Port: 1, Thresholds: Thresholds{FailureThreshold: 2}}
+	sleep := func(time.Duration) {}
+
+	results := []bool{true, false, false}
+	want := []string{
+		"connectivity.state:1|g|#state:up,",
+		"connectivity.state:1|g|#state:up,",
+		"connectivity.state:2|g|#state:down,",
+	}
+
+	confidence := 1
+	for i, r := range results {
+		r := r
+		confidence = dest.monitorWithCheck(confidence, func() bool { return r }, sleep)
+		if got := recvQueue(t); !strings.HasPrefix(got, want[i]) {
+			t.Errorf("iteration %d enqueued %q; want prefix %q", i, got, want[i])
+		}
+	}
+}
+
+// TestMonitorWithCheckHoldsConfidenceThroughAbsorbedFailure verifies that a
+// failure the failure threshold absorbs holds the confidence ramp where it is,
+// and that only a confirmed outage resets it.
+func TestMonitorWithCheckHoldsConfidenceThroughAbsorbedFailure(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	dest := &Destination{Label: "stub", Host: "host", Port: 1, Thresholds: Thresholds{FailureThreshold: 2}}
+
+	var sleeps []time.Duration
+	sleep := func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	results := []bool{true, true, true, false, true, false, false}
+	want := []time.Duration{
+		2 * time.Minute,
+		3 * time.Minute,
+		4 * time.Minute,
+		4 * time.Minute, // absorbed
+		5 * time.Minute,
+		5 * time.Minute, // absorbed
+		1 * time.Minute, // down
+	}
+
+	confidence := 1
+	for _, r := range results {
+		r := r
+		confidence = dest.monitorWithCheck(confidence, func() bool { return r }, sleep)
+	}
+
+	for i := range want {
+		if sleeps[i] != want[i] {
+			t.Errorf("sleeps[%d] = %v; want %v", i, sleeps[i], want[i])
+		}
+	}
+}
+
+// TestMonitorWithCheckLogsStateChanges verifies that what a check logs is held
+// back while results build toward a threshold, and printed when they change
+// the destination's State or confirm it's down.
+func TestMonitorWithCheckLogsStateChanges(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	var output strings.Builder
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	dest := &Destination{Label: "stub", Host: "host", Port: 1, Thresholds: Thresholds{FailureThreshold: 2, SuccessThreshold: 2}}
+	sleep := func(time.Duration) {}
+
+	// Lines are held back while building toward a threshold (the first
+	// failure, a success while down, a failure while up), and every failure
+	// is logged while down
+	results := []bool{false, false, false, true, true, true, false}
+	printed := []bool{false, true, true, false, true, true, false}
+
+	confidence := 1
+	for i, r := range results {
+		r := r
+		output.Reset()
+		check := func() bool {
+			LogDestination(dest, "probe detail")
+			return r
+		}
+		confidence = dest.monitorWithCheck(confidence, check, sleep)
+		if got := strings.Contains(output.String(), "probe detail"); got != printed[i] {
+			t.Errorf("iteration %d printed the check's log = %v; want %v (output: %q)", i, got, printed[i], output.String())
+		}
+	}
+	if dest.logs != nil {
+		t.Errorf("logs = %v; want nil once the check is done", dest.logs)
+	}
+}
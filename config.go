@@ -2,23 +2,67 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"slices"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	StatsdHost     string `yaml:"statsd_host"`
-	StatsdPort     int    `yaml:"statsd_port"`
-	StatsdProtocol string `yaml:"statsd_protocol"`
-	URLs           []Url
+	StatsdHost     string         `yaml:"statsd_host"`
+	StatsdPort     int            `yaml:"statsd_port"`
+	StatsdProtocol string         `yaml:"statsd_protocol"`
+	History        HistoryConfig  `yaml:"history"`
+	Ping           PingOptions    `yaml:"ping"`
+	Resolver       ResolverConfig `yaml:"resolver"`
+	Resolve        []string       `yaml:"resolve"`
+	Proxy          string         `yaml:"proxy"`
+	URLs           []Url          `yaml:"-"`
 }
 
+// ConfigKeys are the top-level YAML keys that configure connectivity itself.
+// Every other top-level key is a destination label.
+var ConfigKeys = map[string]bool{
+	"statsd_host":     true,
+	"statsd_port":     true,
+	"statsd_protocol": true,
+	"history":         true,
+	"ping":            true,
+	"resolver":        true,
+	"resolve":         true,
+	"proxy":           true,
+}
+
+// Url is a single destination from the config file. It may be written either
+// as a bare URL string or as a mapping with a `url` key plus per-destination
+// options:
+//
+//	web:
+//	  url: https://example.com/health
+//	  interval: 30s
 type Url struct {
-	Label string `yaml:"-"`
-	Url   string `yaml:"-"`
+	Label      string `yaml:"-"`
+	Url        string `yaml:"url"`
+	Schedule   `yaml:",inline"`
+	Thresholds `yaml:",inline"`
+	Ping       PingOptions      `yaml:"ping"`
+	Resolver   ResolverConfig   `yaml:"resolver"`
+	Resolve    []string         `yaml:"resolve"`
+	Proxy      string           `yaml:"proxy"`
+	TLS        TLSOptions       `yaml:"tls"`
+	SourceIP   string           `yaml:"source_ip"`
+	Interface  string           `yaml:"interface"`
+	Script     []ScriptStep     `yaml:"script"`
+	WebSocket  WebSocketOptions `yaml:"websocket"`
+	SSH        SSHOptions       `yaml:"ssh"`
+
+	// The SRV record this URL was expanded from, if any
+	SRV *net.SRV `yaml:"-"`
 }
 
 func (u Url) String() string {
@@ -54,17 +98,44 @@ func LoadConfig(path string) *Config {
 
 	log.Printf("Loading config from %s", path)
 
-	var configMap map[string]string
+	var configMap map[string]yaml.Node
 	err = yaml.Unmarshal(f, &configMap)
 	if err != nil {
 		log.Fatalf("Failed to parse YAML config file (%s): %v", path, err)
 	}
 
+	for k, v := range configMap {
+		if err := checkConfigKey(k, v); err != nil {
+			log.Fatalf("Invalid config file (%s): %v", path, err)
+		}
+	}
+
 	var cfg Config
+	err = yaml.Unmarshal(f, &cfg)
+	if err != nil {
+		log.Fatalf("Failed to parse YAML config file (%s): %v", path, err)
+	}
+	if err := cfg.History.Validate(); err != nil {
+		log.Fatalf("Invalid history config (%s): %v", path, err)
+	}
 
 	// Extract the URL labels & values from the struct
 	for k, v := range configMap {
-		cfg.URLs = append(cfg.URLs, Url{Label: k, Url: v})
+		if ConfigKeys[k] {
+			continue
+		}
+
+		u := Url{Label: k}
+		err = decodeDefaults(configMap, &u)
+		if err == nil && v.Kind == yaml.MappingNode {
+			err = v.Decode(&u)
+		} else if err == nil {
+			err = v.Decode(&u.Url)
+		}
+		if err != nil {
+			log.Fatalf("Failed to parse YAML config file (%s): %s: %v", path, k, err)
+		}
+		cfg.URLs = append(cfg.URLs, u)
 	}
 
 	// Apply some default values
@@ -80,3 +151,60 @@ func LoadConfig(path string) *Config {
 
 	return &cfg
 }
+
+// checkConfigKey rejects a URL given for a key in ConfigKeys, which is most
+// likely a destination that happens to share its label. Only the proxy
+// setting is a URL itself, and only of a proxy.
+func checkConfigKey(key string, node yaml.Node) error {
+	if !ConfigKeys[key] || node.Kind != yaml.ScalarNode {
+		return nil
+	}
+	u, err := url.Parse(node.Value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil
+	}
+	isProxy := u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "socks5"
+	if key == "proxy" && isProxy && (u.Path == "" || u.Path == "/") && u.RawQuery == "" {
+		return nil
+	}
+	return errors.New(fmt.Sprintf("%s is a reserved key, so it can't label a destination; rename the destination (%s)", key, node.Value))
+}
+
+// decodeDefaults applies global options to a destination, which may then
+// override them. The options are decoded afresh for each destination, rather
+// than copied from Config, so that no pointers are shared between them.
+func decodeDefaults(configMap map[string]yaml.Node, u *Url) error {
+	defaults := map[string]interface{}{
+		"ping":     &u.Ping,
+		"resolver": &u.Resolver,
+		"resolve":  &u.Resolve,
+		"proxy":    &u.Proxy,
+	}
+	for key, out := range defaults {
+		if node, ok := configMap[key]; ok {
+			if err := node.Decode(out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyDefaults applies global options to a destination given on the command
+// line, copying them like decodeDefaults so that no pointers are shared.
+func copyDefaults(config *Config, u *Url) {
+	u.Ping = config.Ping
+	if config.Ping.MaxLoss != nil {
+		maxLoss := *config.Ping.MaxLoss
+		u.Ping.MaxLoss = &maxLoss
+	}
+	if config.Ping.Privileged != nil {
+		privileged := *config.Ping.Privileged
+		u.Ping.Privileged = &privileged
+	}
+	u.Resolver = config.Resolver
+	u.Resolver.Nameservers = slices.Clone(config.Resolver.Nameservers)
+	u.Resolver.Search = slices.Clone(config.Resolver.Search)
+	u.Resolve = slices.Clone(config.Resolve)
+	u.Proxy = config.Proxy
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,8 +11,8 @@ import (
 /*
 
 This module is responsible for parsing CLI arguments and return codes. It
-handles the top-level subcommands and main loops for each (check, wait, and
-monitor). All goroutines are managed here.
+handles the top-level subcommands and main loops for each (check, wait,
+monitor, and report). All goroutines are managed here.
 
 */
 
@@ -46,6 +47,7 @@ func main() {
 		destinations := ParseDestinations(urls)
 		log.Print("Checking all connectivity...")
 		ShowDestinations(destinations)
+		ShowPingPermissions(destinations)
 		if CheckLoop(destinations) {
 			os.Exit(0)
 		} else {
@@ -58,17 +60,47 @@ func main() {
 		urls := GetURLs(config)
 		destinations := ParseDestinations(urls)
 		ShowDestinations(destinations)
+		ShowPingPermissions(destinations)
 		log.Print("Waiting until all connectivity is validated...")
 		WaitLoop(destinations)
 	} else if command == "monitor" {
+		var err error
 		configPath, _ := FindConfig()
 		config := LoadConfig(configPath)
 		go StatsdSender(config)
 		urls := GetURLs(config)
 		destinations := ParseDestinations(urls)
 		ShowDestinations(destinations)
+		ShowPingPermissions(destinations)
+		if config.History.Path != "" {
+			history, err = OpenHistory(config.History)
+			if err != nil {
+				log.Fatalf("Failed to open history (%s): %v", config.History.Path, err)
+			}
+			log.Printf("Recording results to %s", config.History.Path)
+		}
 		log.Print("Monitoring connectivity...")
 		MonitorLoop(destinations)
+	} else if command == "report" {
+		since, ok := ParseReportArgs(os.Args[2:])
+		if !ok {
+			PrintCommandUsage(command)
+			os.Exit(2)
+		}
+		configPath, _ := FindConfig()
+		config := LoadConfig(configPath)
+		if config.History.Path == "" {
+			log.Fatal("No history path is configured; see \"connectivity help report\"")
+		}
+		now := time.Now()
+		// Read everything retained, since the result before the period
+		// tells how the period began
+		results, err := ReadHistory(config.History.Path, time.Time{})
+		if err != nil {
+			log.Fatalf("Failed to read history (%s): %v", config.History.Path, err)
+		}
+		slo := config.History.slo()
+		PrintReport(os.Stdout, BuildReport(results, now.Add(-since), now, slo), now.Add(-since), slo)
 	} else if command == "version" {
 		PrintVersion()
 	} else if command == "help" {
@@ -99,19 +131,49 @@ func GetURLs(config *Config) []Url {
 		config.URLs = []Url{}
 
 		for _, url := range os.Args[1:len(os.Args)] {
-			config.URLs = append(config.URLs, Url{Url: url})
+			u := Url{Url: url}
+			copyDefaults(config, &u)
+			config.URLs = append(config.URLs, u)
 		}
 	}
 	return config.URLs
 }
 
+// ParseReportArgs parses the arguments to `connectivity report`, returning the
+// report period and whether the arguments were valid.
+func ParseReportArgs(args []string) (time.Duration, bool) {
+	since := DefaultReportPeriod
+	for i := 0; i < len(args); i++ {
+		value, found := strings.CutPrefix(args[i], "--since=")
+		if !found && args[i] == "--since" && i+1 < len(args) {
+			i += 1
+			value, found = args[i], true
+		}
+		if !found {
+			return 0, false
+		}
+
+		var err error
+		since, err = ParseSince(value)
+		if err != nil {
+			log.Print(err)
+			return 0, false
+		}
+	}
+	return since, true
+}
+
 func ParseDestinations(urls []Url) []*Destination {
 	// Validate all destinations before beginning any monitoring
 	errEncountered := false
 	var destinations []*Destination
 	for idx, url := range urls {
 		if idx != 0 {
-			dest, err := NewDestination(url)
+			newDestination := NewDestination
+			if IsSRV(url.Url) {
+				newDestination = NewSRVDestination
+			}
+			dest, err := newDestination(url)
 			if err != nil {
 				log.Printf("%s", err)
 				errEncountered = true
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+
+This module compares the answers of every nameserver a destination's resolver
+is configured with. Because a lookup only needs one nameserver to answer, a
+nameserver serving stale records would otherwise only be noticed by the
+clients that happened to ask it.
+
+*/
+
+// NameserverAnswer is a single nameserver's answer to a query for a name.
+type NameserverAnswer struct {
+	Nameserver Nameserver
+
+	// The sorted addresses returned, or "no such host"
+	Answer string
+
+	// Set if the nameserver failed to answer at all
+	Err error
+}
+
+// Compare asks every nameserver for the A records of name, concurrently,
+// returning their answers in the order the nameservers are configured.
+func (r *Resolver) Compare(ctx context.Context, name string) []NameserverAnswer {
+	answers := make([]NameserverAnswer, len(r.Nameservers))
+	var wg sync.WaitGroup
+	for i, ns := range r.Nameservers {
+		wg.Add(1)
+		go func(i int, ns Nameserver) {
+			defer wg.Done()
+			answers[i] = NameserverAnswer{Nameserver: ns}
+
+			ips, err := r.queryNameserver(ctx, ns, name)
+			var dnsErr *net.DNSError
+			if err != nil && errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				answers[i].Answer = "no such host"
+			} else if err != nil {
+				answers[i].Err = err
+			} else {
+				answers[i].Answer = formatIPs(ips)
+			}
+		}(i, ns)
+	}
+	wg.Wait()
+	return answers
+}
+
+func formatIPs(ips []net.IP) string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
+
+// Divergent returns the consensus answer (the most common one, with ties
+// going to the earliest nameserver), and the answers that disagree with it.
+// Nameservers that failed to answer are ignored.
+func Divergent(answers []NameserverAnswer) (string, []NameserverAnswer) {
+	counts := map[string]int{}
+	consensus := ""
+	for _, a := range answers {
+		if a.Err != nil {
+			continue
+		}
+		counts[a.Answer]++
+		if consensus == "" || counts[a.Answer] > counts[consensus] {
+			consensus = a.Answer
+		}
+	}
+
+	var divergent []NameserverAnswer
+	for _, a := range answers {
+		if a.Err == nil && a.Answer != consensus {
+			divergent = append(divergent, a)
+		}
+	}
+	return consensus, divergent
+}
+
+// CheckConsistency compares the answers of each of the destination's
+// nameservers for name, if the resolver is configured to. Disagreement is
+// always logged, but only returned as an error if the resolver's consistency
+// mode is "fail".
+func CheckConsistency(dest *Destination, name string) error {
+	r := dest.resolver()
+	if r.Consistency == "" || len(r.Nameservers) < 2 {
+		return nil
+	}
+
+	answers := r.Compare(context.Background(), name)
+	for _, a := range answers {
+		if a.Err != nil {
+			LogDestinationError(dest, fmt.Sprintf("Unable to compare answers for %s from %s", name, a.Nameserver), a.Err)
+		}
+	}
+
+	consensus, divergent := Divergent(answers)
+	if len(divergent) == 0 {
+		dest.Increment("connectivity.lookup.consistent", []string{})
+		return nil
+	}
+
+	for _, a := range divergent {
+		dest.Increment("connectivity.lookup.divergent", []string{fmt.Sprintf("nameserver:%s", EscapeTag(a.Nameserver.String()))})
+		LogDestination(dest, fmt.Sprintf("Nameserver %s answered [%s] for %s; others answered [%s]", a.Nameserver, a.Answer, name, consensus))
+	}
+
+	if r.Consistency == "fail" {
+		return errors.New(fmt.Sprintf("%d of %d nameservers disagree about %s", len(divergent), len(answers), name))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDivergent(t *testing.T) {
+	answers := []NameserverAnswer{
+		{Nameserver: Nameserver{Address: "a:53", Transport: "udp"}, Answer: "192.0.2.1"},
+		{Nameserver: Nameserver{Address: "b:53", Transport: "udp"}, Answer: "192.0.2.9"},
+		{Nameserver: Nameserver{Address: "c:53", Transport: "udp"}, Err: fmt.Errorf("i/o timeout")},
+		{Nameserver: Nameserver{Address: "d:53", Transport: "udp"}, Answer: "192.0.2.1"},
+	}
+	consensus, divergent := Divergent(answers)
+	if consensus != "192.0.2.1" {
+		t.Errorf("consensus = %q; want 192.0.2.1", consensus)
+	}
+	if len(divergent) != 1 || divergent[0].Nameserver.Address != "b:53" {
+		t.Errorf("divergent = %+v; want only b:53", divergent)
+	}
+
+	// With no majority, the first nameserver wins
+	consensus, divergent = Divergent(answers[:2])
+	if consensus != "192.0.2.1" || len(divergent) != 1 || divergent[0].Nameserver.Address != "b:53" {
+		t.Errorf("Divergent(a, b) = %q, %+v; want 192.0.2.1 and b:53", consensus, divergent)
+	}
+}
+
+func TestResolverCompare(t *testing.T) {
+	good := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.2"), aRecord("www.example.test", "192.0.2.1"))
+	stale := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.99"))
+	empty := newTestDNSServer(t)
+
+	r, err := NewResolver(ResolverConfig{Nameservers: []string{good.Addr, stale.Addr, empty.Addr}}, nil)
+	assertNoError(t, "NewResolver", err)
+	answers := r.Compare(context.Background(), "www.example.test")
+	want := []string{"192.0.2.1, 192.0.2.2", "192.0.2.99", "no such host"}
+	for i, a := range answers {
+		if a.Err != nil || a.Answer != want[i] {
+			t.Errorf("answers[%d] = %q (%v); want %q", i, a.Answer, a.Err, want[i])
+		}
+	}
+}
+
+func newConsistencyDestination(t *testing.T, consistency string, servers ...*testDNSServer) *Destination {
+	t.Helper()
+	var nameservers []string
+	for _, server := range servers {
+		nameservers = append(nameservers, server.Addr)
+	}
+	dest, err := NewDestination(Url{
+		Label:    "www",
+		Url:      "https://www.example.test",
+		Resolver: ResolverConfig{Nameservers: nameservers, Consistency: consistency}})
+	assertNoError(t, "NewDestination", err)
+	return dest
+}
+
+func TestLookupConsistency(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	primary := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.1"))
+	secondary := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.1"))
+	stale := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.99"))
+
+	cases := []struct {
+		consistency string
+		servers     []*testDNSServer
+		wantErr     bool
+		wantMetric  string
+	}{
+		{consistency: "fail", servers: []*testDNSServer{primary, secondary}, wantMetric: "connectivity.lookup.consistent:"},
+		{consistency: "warn", servers: []*testDNSServer{primary, secondary, stale}, wantMetric: "connectivity.lookup.divergent:"},
+		{consistency: "fail", servers: []*testDNSServer{primary, secondary, stale}, wantErr: true, wantMetric: "connectivity.lookup.divergent:"},
+	}
+	for _, tc := range cases {
+		dest := newConsistencyDestination(t, tc.consistency, tc.servers...)
+		drainQueue(t)
+
+		ips, err := Lookup(dest)
+		if tc.wantErr {
+			assertErrorContains(t, err, "1 of 3 nameservers disagree about www.example.test")
+		} else {
+			assertNoError(t, "Lookup", err)
+			assertLookupEquals(t, ips, []net.IP{net.ParseIP("192.0.2.1")})
+		}
+
+		// Skip the lookup timer
+		recvQueue(t)
+		got := recvQueue(t)
+		if !strings.HasPrefix(got, tc.wantMetric) {
+			t.Errorf("%s: enqueued %q; want %s", tc.consistency, got, tc.wantMetric)
+		}
+		if tc.wantMetric == "connectivity.lookup.divergent:" && !strings.Contains(got, "nameserver:udp-//"+EscapeTag(stale.Addr)) {
+			t.Errorf("%s: enqueued %q; want it tagged with the stale nameserver", tc.consistency, got)
+		}
+		drainQueue(t)
+	}
+}
+
+func TestLookupConsistencyIgnoresUnreachableNameservers(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	primary := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.1"))
+	broken := newTestDNSServer(t)
+	broken.setRCode("*", dnsmessage.RCodeServerFailure)
+
+	dest := newConsistencyDestination(t, "fail", primary, broken)
+	_, err := Lookup(dest)
+	assertNoError(t, "Lookup", err)
+}
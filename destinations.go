@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"log"
 	"net"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -29,13 +32,65 @@ type Destination struct {
 	Host        string
 	Port        int
 	Path        string
+	Schedule    Schedule
+	Thresholds  Thresholds
+	Ping        PingOptions
+	DNS         *DNSCheck
+	UDP         *UDPProbe
+	Script      *Script
+	Database    *DatabaseCheck
+	Redis       *RedisCheck
+	GRPC        *GRPCCheck
+	WebSocket   *WebSocketCheck
+	LDAP        *LDAPCheck
+	SSH         *SSHCheck
+	NTP         *NTPCheck
+	Resolver    *Resolver
+	Proxy       *Proxy
+
+	// The local address that connections and pings are sent from, if not
+	// the kernel's choice
+	Bind *SourceBinding
+
+	// Optional TLS configuration for checks that negotiate TLS themselves
+	TLSConfig *tls.Config
+
+	// The SRV record this destination was expanded from, if any
+	SRV *net.SRV
+
+	// For srv:// destinations, what to expand into a destination per target
+	Expansion *SRVExpansion
+
+	// Only used by Monitor
+	health *Health
+
+	// While Monitor runs a check, log lines are held here until the check's
+	// effect on health is known (see logf)
+	logs []string
+
+	// The class of the last lookup failure (see LookupDiagnosis), if the last
+	// check failed to resolve the host
+	lookupError string
+
+	// The client for HTTP(S) checks (see httpClient)
+	client *http.Client
+
+	// The route warnings last logged for each address, so that they're only
+	// logged again when they change (see route)
+	routeWarnings map[string]string
 }
 
 func (dest Destination) String() string {
+	return fmt.Sprintf("%s:", dest.Name())
+}
+
+// Name identifies the destination by its label, falling back to its URL (with
+// any password redacted).
+func (dest *Destination) Name() string {
 	if dest.Label != "" {
-		return fmt.Sprintf("%s:", dest.Label)
+		return dest.Label
 	} else {
-		return fmt.Sprintf("%s:", dest.UrlString())
+		return dest.UrlString()
 	}
 }
 
@@ -65,14 +120,25 @@ func (dest *Destination) UrlString() string {
 	return s
 }
 
+// HostPort returns the destination's host and port, suitable for dialing.
+func (dest *Destination) HostPort() string {
+	return net.JoinHostPort(dest.Host, strconv.Itoa(dest.Port))
+}
+
 func (dest *Destination) tags() []string {
-	return []string{
+	tags := []string{
 		fmt.Sprintf("dest_label:%s", EscapeTag(dest.Label)),
 		fmt.Sprintf("dest_scheme:%s", EscapeTag(dest.Scheme)),
 		fmt.Sprintf("dest_host:%s", EscapeTag(dest.Host)),
 		fmt.Sprintf("dest_port:%d", dest.Port),
 		fmt.Sprintf("dest_protocol:%s", EscapeTag(dest.Protocol)),
 	}
+	if dest.SRV != nil {
+		tags = append(tags,
+			fmt.Sprintf("srv_priority:%d", dest.SRV.Priority),
+			fmt.Sprintf("srv_weight:%d", dest.SRV.Weight))
+	}
+	return tags
 }
 
 func (dest *Destination) Increment(metric string, tags []string) {
@@ -80,6 +146,11 @@ func (dest *Destination) Increment(metric string, tags []string) {
 	Increment(metric, tags)
 }
 
+func (dest *Destination) Gauge(metric string, value int, tags []string) {
+	tags = append(tags, dest.tags()...)
+	Gauge(metric, value, tags)
+}
+
 func (dest *Destination) Timer(metric string, took time.Duration, tags []string) {
 	tags = append(tags, dest.tags()...)
 	Timer(metric, took, tags)
@@ -117,6 +188,40 @@ func NewDestination(u Url) (*Destination, error) {
 			// If Go adopts support for one of these, this code won't be reached.
 			if scheme == "nats" {
 				portNumber = 4222
+			} else if scheme == "dns" {
+				portNumber = 53
+			} else if scheme == "smtps" {
+				portNumber = 465
+			} else if scheme == "postgres" || scheme == "postgresql" {
+				portNumber = 5432
+			} else if scheme == "mysql" {
+				portNumber = 3306
+			} else if scheme == "redis" || scheme == "rediss" {
+				portNumber = 6379
+			} else if scheme == "memcached" {
+				portNumber = 11211
+			} else if scheme == "amqp" {
+				portNumber = 5672
+			} else if scheme == "amqps" {
+				portNumber = 5671
+			} else if scheme == "mqtt" {
+				portNumber = 1883
+			} else if scheme == "mqtts" {
+				portNumber = 8883
+			} else if scheme == "kafka" {
+				portNumber = 9092
+			} else if scheme == "ldap" {
+				portNumber = 389
+			} else if scheme == "ldaps" {
+				portNumber = 636
+			} else if scheme == "ssh" {
+				portNumber = 22
+			} else if scheme == "ntp" {
+				portNumber = 123
+			} else if scheme == "grpc" || scheme == "ws" {
+				portNumber = 80
+			} else if scheme == "grpcs" || scheme == "wss" {
+				portNumber = 443
 			} else if scheme == "icmp" {
 				portNumber = -1
 			} else {
@@ -131,47 +236,224 @@ func NewDestination(u Url) (*Destination, error) {
 		protocol = scheme
 	}
 
+	var dnsCheck *DNSCheck
+	if scheme == "dns" {
+		dnsCheck, err = ParseDNSCheck(url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid DNS check: %v", u, err))
+		}
+		protocol = dnsCheck.Transport
+
+		// DNS-over-TLS and DNS-over-HTTPS have their own well-known ports
+		if dnsCheck.Transport == "tls" || dnsCheck.Transport == "https" {
+			protocol = "tcp"
+			if port == "" {
+				portNumber, _ = strconv.Atoi(dnsPorts[dnsCheck.Transport])
+			}
+		}
+	}
+
+	var ntpCheck *NTPCheck
+	if scheme == "ntp" {
+		ntpCheck, err = ParseNTPCheck(url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid NTP check: %v", u, err))
+		}
+		protocol = "udp"
+	}
+
+	var udpProbe *UDPProbe
+	if scheme == "udp" {
+		udpProbe, err = ParseUDPProbe(url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid UDP probe: %v", u, err))
+		}
+	}
+
+	var databaseCheck *DatabaseCheck
+	if IsDatabase(scheme) {
+		databaseCheck, err = ParseDatabaseCheck(url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid database check: %v", u, err))
+		}
+		if err := databaseCheck.CheckTLSOptions(u.TLS); err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid database check: %v", u, err))
+		}
+	}
+
+	var redisCheck *RedisCheck
+	if IsRedis(scheme) {
+		redisCheck, err = ParseRedisCheck(url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid Redis check: %v", u, err))
+		}
+	}
+
+	var grpcCheck *GRPCCheck
+	if IsGRPC(scheme) {
+		grpcCheck, err = ParseGRPCCheck(url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid gRPC check: %v", u, err))
+		}
+	}
+
+	var webSocketCheck *WebSocketCheck
+	if IsWebSocket(scheme) {
+		webSocketCheck, err = NewWebSocketCheck(u.WebSocket)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid websocket options: %v", u, err))
+		}
+	} else if !u.WebSocket.IsZero() {
+		return nil, errors.New(fmt.Sprintf("%s: WebSocket options are only supported by ws:// and wss:// destinations: %v", u, u.Url))
+	}
+
+	var ldapCheck *LDAPCheck
+	if IsLDAP(scheme) {
+		ldapCheck, err = ParseLDAPCheck(url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid LDAP check: %v", u, err))
+		}
+	}
+
+	var sshCheck *SSHCheck
+	if scheme == "ssh" {
+		sshCheck, err = NewSSHCheck(u.SSH, url.User.Username())
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: Invalid ssh options: %v", u, err))
+		}
+	} else if !u.SSH.IsZero() {
+		return nil, errors.New(fmt.Sprintf("%s: SSH options are only supported by ssh:// destinations: %v", u, u.Url))
+	}
+
+	script, err := CompileScript(u.Script)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid script: %v", u, err))
+	}
+	if script != nil && scheme != "tcp" {
+		return nil, errors.New(fmt.Sprintf("%s: Scripts are only supported by tcp:// destinations: %v", u, u.Url))
+	}
+
+	if err := u.Schedule.Validate(); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid schedule: %v", u, err))
+	}
+	if err := u.Thresholds.Validate(); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid thresholds: %v", u, err))
+	}
+	if err := u.Ping.Validate(); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid ping options: %v", u, err))
+	}
+	resolver, err := NewResolver(u.Resolver, u.Resolve)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid resolver: %v", u, err))
+	}
+	proxy, err := NewProxy(u.Proxy)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid proxy: %v", u, err))
+	}
+	bind, err := NewSourceBinding(u.SourceIP, u.Interface)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid source: %v", u, err))
+	}
+	if proxy != nil && bind != nil {
+		proxy.forward.LocalAddr = bind.localAddr("tcp")
+	}
+	tlsConfig, err := NewTLSConfig(u.TLS)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: Invalid tls options: %v", u, err))
+	}
+	if dnsCheck != nil {
+		dnsCheck.TLSConfig = tlsConfig
+	}
+	if script != nil {
+		script.TLSConfig = tlsConfig
+	}
+
 	username := url.User.Username()
 	password, passwordSet := url.User.Password()
 
-	return &Destination{
-			Label:       u.Label,
-			URL:         u.Url,
-			Protocol:    protocol,
-			Scheme:      scheme,
-			Username:    username,
-			Password:    password,
-			PasswordSet: passwordSet,
-			Host:        host,
-			Port:        portNumber,
-			Path:        url.Path},
-		nil
+	dest := &Destination{
+		Label:       u.Label,
+		URL:         u.Url,
+		Protocol:    protocol,
+		Scheme:      scheme,
+		Username:    username,
+		Password:    password,
+		PasswordSet: passwordSet,
+		Host:        host,
+		Port:        portNumber,
+		Path:        url.Path,
+		Schedule:    u.Schedule,
+		Thresholds:  u.Thresholds,
+		Ping:        u.Ping,
+		DNS:         dnsCheck,
+		UDP:         udpProbe,
+		Script:      script,
+		Database:    databaseCheck,
+		Redis:       redisCheck,
+		GRPC:        grpcCheck,
+		WebSocket:   webSocketCheck,
+		LDAP:        ldapCheck,
+		SSH:         sshCheck,
+		NTP:         ntpCheck,
+		TLSConfig:   tlsConfig,
+		Resolver:    resolver,
+		Proxy:       proxy,
+		Bind:        bind,
+		SRV:         u.SRV}
+
+	// Nameservers are reached the same way as the destination itself
+	for i := range resolver.Nameservers {
+		resolver.Nameservers[i].Dial = dest.dial
+	}
+	return dest, nil
 }
 
 func (dest *Destination) Check() bool {
+	// Each target is checked as a destination of its own
+	if dest.Expansion != nil {
+		return CheckSRV(dest)
+	}
+
 	dest.Increment("connectivity.check", []string{})
 
 	// Assume the destination is reachable until proven otherwise
 	reachable := true
 
+	dest.lookupError = ""
 	dnsResults, err := Lookup(dest)
 	if err != nil {
 		LogDestinationError(dest, "Failed to resolve host", err)
+		var lookupErr *LookupError
+		if errors.As(err, &lookupErr) {
+			dest.lookupError = lookupErr.Diagnosis.Class
+			for _, line := range lookupErr.Diagnosis.Lines() {
+				LogDestination(dest, line)
+			}
+		}
 		reachable = false
 	}
 
+	// Nothing beyond the proxy can be reached without it
+	if reachable && dest.proxied() {
+		reachable = CheckProxy(dest)
+	}
+
 	if reachable {
 		for _, ip := range dnsResults {
 			// Check that this isn't an IPv6 result
 			if !strings.Contains(ip.String(), ":") {
 				// Check destination IP for routability
-				route, err := GetRoute(ip)
+				route, err := dest.route(ip)
 				if err != nil {
 					LogDestinationError(dest, fmt.Sprintf("Failed to route to %s", ip.String()), err)
 				}
 
 				if dest.Protocol == "icmp" {
 					reachable = reachable && Ping(route, dest, ip)
+				} else if dest.UDP != nil {
+					reachable = reachable && UDP(route, dest, ip)
+				} else if dest.Script != nil {
+					reachable = reachable && TCPScript(route, dest, ip)
 				} else {
 					reachable = reachable && Dial(route, dest, ip)
 				}
@@ -182,11 +464,41 @@ func (dest *Destination) Check() bool {
 	if reachable {
 		if dest.Scheme == "http" || dest.Scheme == "https" {
 			reachable = reachable && HTTPS(dest)
+		} else if dest.Scheme == "dns" {
+			reachable = reachable && DNS(dest)
+		} else if dest.Scheme == "smtp" || dest.Scheme == "smtps" {
+			reachable = reachable && SMTP(dest)
+		} else if dest.Database != nil {
+			reachable = reachable && Database(dest)
+		} else if dest.Redis != nil {
+			reachable = reachable && Redis(dest)
+		} else if dest.Scheme == "memcached" {
+			reachable = reachable && Memcached(dest)
+		} else if dest.Scheme == "nats" {
+			reachable = reachable && NATS(dest)
+		} else if dest.GRPC != nil {
+			reachable = reachable && GRPC(dest)
+		} else if dest.WebSocket != nil {
+			reachable = reachable && WebSocket(dest)
+		} else if dest.Scheme == "amqp" || dest.Scheme == "amqps" {
+			reachable = reachable && AMQP(dest)
+		} else if dest.Scheme == "mqtt" || dest.Scheme == "mqtts" {
+			reachable = reachable && MQTT(dest)
+		} else if dest.Scheme == "kafka" {
+			reachable = reachable && Kafka(dest)
+		} else if dest.LDAP != nil {
+			reachable = reachable && LDAP(dest)
+		} else if dest.SSH != nil {
+			reachable = reachable && SSH(dest)
+		} else if dest.NTP != nil {
+			reachable = reachable && NTP(dest)
 		}
 	}
 
 	if reachable {
 		dest.Increment("connectivity.check.success", []string{})
+	} else if dest.lookupError != "" {
+		dest.Increment("connectivity.check.error", []string{fmt.Sprintf("lookup.error:%s", dest.lookupError)})
 	} else {
 		dest.Increment("connectivity.check.error", []string{})
 	}
@@ -197,34 +509,106 @@ func (dest *Destination) Check() bool {
 func (dest *Destination) Monitor() {
 	confidence := 1
 
+	// Spread out the first round of checks, too
+	time.Sleep(dest.Schedule.Splay())
+
 	for {
 		confidence = dest.monitorWithCheck(confidence, dest.Check, time.Sleep)
 	}
 }
 
 // monitorWithCheck runs one iteration of the Monitor loop: invoke check,
-// adjust confidence per the #16 reset-on-failure rule, then sleep. The
-// confidence value is threaded through the caller (rather than held in a
-// closure) so a test can drive a deterministic sequence of iterations
-// without spawning a goroutine. The injected sleep lets the test observe
-// the chosen sleep duration without waiting on a real clock.
+// update the destination's Health and history, adjust confidence per the #16
+// reset-on-failure rule, then sleep for as long as the destination's Schedule
+// dictates. Confidence and the check's logs follow the destination's State
+// rather than the raw result of the check, so a failure absorbed by
+// failure_threshold neither resets the ramp nor gets logged, and an ongoing
+// outage is only logged once. The confidence value is threaded through the
+// caller (rather than held in a closure) so a test can drive a deterministic
+// sequence of iterations without spawning a goroutine. The injected sleep
+// lets the test observe the chosen sleep duration without waiting on a real
+// clock.
 //
 // see #17 -- Monitor itself still has no termination condition, no panic
 // recovery, and no context.Context; those land with the lifecycle work.
 func (dest *Destination) monitorWithCheck(confidence int, check func() bool, sleep func(time.Duration)) int {
-	if check() {
+	start := time.Now()
+	dest.logs = []string{}
+	healthy := check()
+	took := time.Since(start)
+	logs := dest.logs
+	dest.logs = nil
+	up := dest.recordHealth(healthy, logs) == StateUp
+
+	if up && healthy {
 		confidence += 1
-		if confidence > 10 {
-			confidence = 10
+		if max := dest.Schedule.MaxConfidence(); confidence > max {
+			confidence = max
 		}
-	} else {
+	} else if !up {
 		confidence = 1
 	}
 
-	sleep(time.Duration(confidence) * time.Minute)
+	interval := dest.Schedule.Sleep(confidence, up) + dest.Schedule.Splay()
+	dest.recordHistory(start, healthy, took, interval)
+	sleep(interval)
 	return confidence
 }
 
+// recordHealth feeds a check result into the destination's Health, logging
+// any change of State and emitting the current State as a gauge. It returns
+// the current State.
+//
+// The lines the check logged (logs) are dropped while results are building
+// toward a threshold, such as a failure absorbed while up or a success while
+// down, and printed otherwise, so that every failure is logged once a
+// destination is down or flapping.
+func (dest *Destination) recordHealth(ok bool, logs []string) State {
+	if dest.health == nil {
+		dest.health = &Health{Thresholds: dest.Thresholds}
+	}
+
+	previous := dest.health.Record(ok)
+	state := dest.health.State
+	building := state == StateUnknown || ok != (state == StateUp)
+	if state != previous || !building {
+		for _, line := range logs {
+			log.Print(line)
+		}
+	}
+	if state != previous && previous != StateUnknown {
+		LogDestination(dest, fmt.Sprintf("State changed from %s to %s", previous, dest.health.Describe()))
+	} else if state != previous {
+		LogDestination(dest, fmt.Sprintf("State is %s", dest.health.Describe()))
+	}
+
+	dest.Gauge("connectivity.state", int(state), []string{fmt.Sprintf("state:%s", state)})
+	return state
+}
+
+// recordHistory appends a check result, and how long until the next check,
+// to the history file, if one is open.
+func (dest *Destination) recordHistory(start time.Time, ok bool, took time.Duration, interval time.Duration) {
+	if history == nil {
+		return
+	}
+
+	result := Result{
+		Time:        start.UTC(),
+		Destination: dest.Name(),
+		OK:          ok,
+		DurationMs:  float64(took) / float64(time.Millisecond),
+		IntervalMs:  float64(interval) / float64(time.Millisecond),
+		LookupError: dest.lookupError}
+	if dest.health != nil {
+		result.State = dest.health.State.String()
+	}
+
+	if err := history.Append(result); err != nil {
+		LogDestinationError(dest, "Failed to record result", err)
+	}
+}
+
 func (dest *Destination) WaitFor() {
 	// see #18 -- the 15s flat poll has no overall deadline and no
 	// exponential backoff; that lands with the wait-timeout flag.
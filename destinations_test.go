@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 // testingT is the subset of *testing.T used by the assertion helpers in this
@@ -404,3 +405,8 @@ func TestUrlString_RedactedDoesNotContainPassword(t *testing.T) {
 		t.Errorf("UrlString() = %q; want it to contain redaction marker %q", got, "[...]")
 	}
 }
+
+func TestInvalidScheduleIsRejected(t *testing.T) {
+	_, err := NewDestination(Url{Label: "host", Url: "http://host", Schedule: Schedule{MinInterval: time.Hour, MaxInterval: time.Minute}})
+	assertErrorContains(t, err, "Invalid schedule")
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+
+This module explains failed lookups. Go's resolver errors say little more than
+"no such host", so when a lookup fails, the name is queried again directly,
+and the response is picked apart to classify the failure, follow any CNAME
+chain, and find the zone's authoritative server, so that the failure can be
+reported with a hint about what to do next.
+
+*/
+
+// The file describing the system resolver's nameservers and search list
+var resolvConfPath = "/etc/resolv.conf"
+
+// DNSHop is a single CNAME record in a chain.
+type DNSHop struct {
+	Name   string
+	Target string
+	TTL    uint32
+}
+
+// LookupDiagnosis describes why a lookup failed.
+type LookupDiagnosis struct {
+	// One of nxdomain, not_in_search_domains, nodata, servfail, refused,
+	// timeout, unreachable, inconsistent (see CheckConsistency), or unknown
+	Class string
+
+	// The names that were queried, in order
+	Tried []string
+
+	// The nameserver that answered, and its response code
+	Nameserver string
+	RCode      string
+
+	CNAMEs []DNSHop
+
+	// The number of addresses in the response, and their TTL (the lowest,
+	// if they differ)
+	Addresses int
+	TTL       uint32
+
+	// From the SOA record returned with negative answers
+	Zone        string
+	PrimaryNS   string
+	NegativeTTL uint32
+
+	// The search domains applied, if any
+	Search []string
+}
+
+// LookupError is returned by Lookup, so that the diagnosis of a failure can
+// be reported alongside the error itself.
+type LookupError struct {
+	Err       error
+	Diagnosis *LookupDiagnosis
+}
+
+func (e *LookupError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LookupError) Unwrap() error {
+	return e.Err
+}
+
+// loadResolvConf reads the nameservers, search list and ndots option used by
+// the system resolver, as described in resolv.conf(5).
+func loadResolvConf(path string) ResolverConfig {
+	var config ResolverConfig
+	f, err := os.Open(path)
+	if err != nil {
+		return config
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			config.Nameservers = append(config.Nameservers, fields[1])
+		case "domain", "search":
+			config.Search = fields[1:]
+		case "options":
+			for _, option := range fields[1:] {
+				if value, found := strings.CutPrefix(option, "ndots:"); found {
+					config.Ndots, _ = strconv.Atoi(value)
+				}
+			}
+		}
+	}
+	return config
+}
+
+// diagnosticResolver returns a resolver that queries the same nameservers as
+// r, which for the system resolver are those listed in resolv.conf.
+func diagnosticResolver(r *Resolver) *Resolver {
+	if len(r.Nameservers) > 0 {
+		return r
+	}
+	system, err := NewResolver(loadResolvConf(resolvConfPath), nil)
+	if err != nil {
+		return r
+	}
+	return system
+}
+
+// DiagnoseLookup queries each name that resolving host would try, in order,
+// to explain why the lookup failed with err. Every query shares a single
+// timeout, so that unresponsive nameservers delay a failing check by no more
+// than one timeout.
+func DiagnoseLookup(ctx context.Context, r *Resolver, host string, err error) *LookupDiagnosis {
+	d := &LookupDiagnosis{Class: classifyLookupError(err)}
+	r = diagnosticResolver(r)
+	if len(r.Nameservers) == 0 {
+		return d
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDNSTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	candidates := r.Candidates(host)
+	if len(candidates) > 1 {
+		d.Search = r.Search
+	}
+
+	var exchangeErr error
+	for _, name := range candidates {
+		d.Tried = append(d.Tried, name)
+		response, ns, err := r.exchange(ctx, name, dnsmessage.TypeA)
+		if err != nil {
+			exchangeErr = err
+			break
+		}
+
+		// If every name is missing, the name as given is the one to explain
+		if response.Header.RCode != dnsmessage.RCodeNameError || name == host || d.Nameserver == "" {
+			d.Nameserver = ns.String()
+			d.RCode = DNSRCodeString(response.Header.RCode)
+			d.analyze(response)
+		}
+
+		// Only move on to the next candidate if this one doesn't exist, as
+		// the resolver itself does
+		if response.Header.RCode != dnsmessage.RCodeNameError {
+			break
+		}
+	}
+
+	if d.Nameserver == "" && exchangeErr != nil {
+		d.Class = "unreachable"
+		if isTimeout(exchangeErr) {
+			d.Class = "timeout"
+		}
+		return d
+	}
+
+	switch d.RCode {
+	case "NXDOMAIN":
+		d.Class = "nxdomain"
+		if len(d.Tried) > 1 && strings.Count(host, ".") < r.Ndots {
+			d.Class = "not_in_search_domains"
+		}
+	case "SERVFAIL":
+		d.Class = "servfail"
+	case "REFUSED":
+		d.Class = "refused"
+	case "NOERROR":
+		// Otherwise, the failure was intermittent, so keep its own class
+		if d.Addresses == 0 {
+			d.Class = "nodata"
+		}
+	default:
+		d.Class = strings.ToLower(d.RCode)
+	}
+	return d
+}
+
+// exchange sends a query to each nameserver in turn until one responds,
+// whatever its response code.
+func (r *Resolver) exchange(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, Nameserver, error) {
+	query, err := NewDNSQuery(name, qtype)
+	if err != nil {
+		return nil, Nameserver{}, err
+	}
+
+	var lastErr error
+	for _, ns := range r.Nameservers {
+		queryCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+		response, err := ns.Exchange(queryCtx, query)
+		cancel()
+		if err == nil {
+			return response, ns, nil
+		}
+		lastErr = err
+
+		// Don't bother with the rest once time is up
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, Nameserver{}, lastErr
+}
+
+// analyze records the CNAME chain and authority of a response.
+func (d *LookupDiagnosis) analyze(msg *dnsmessage.Message) {
+	d.CNAMEs, d.Addresses, d.TTL = nil, 0, 0
+	for _, answer := range msg.Answers {
+		if _, ok := answer.Body.(*dnsmessage.AResource); ok {
+			if d.Addresses == 0 || answer.Header.TTL < d.TTL {
+				d.TTL = answer.Header.TTL
+			}
+			d.Addresses++
+		} else if cname, ok := answer.Body.(*dnsmessage.CNAMEResource); ok {
+			d.CNAMEs = append(d.CNAMEs, DNSHop{
+				Name:   formatDNSName(answer.Header.Name),
+				Target: formatDNSName(cname.CNAME),
+				TTL:    answer.Header.TTL})
+		}
+	}
+
+	d.Zone, d.PrimaryNS, d.NegativeTTL = "", "", 0
+	for _, authority := range msg.Authorities {
+		if soa, ok := authority.Body.(*dnsmessage.SOAResource); ok {
+			d.Zone = formatDNSName(authority.Header.Name)
+			d.PrimaryNS = formatDNSName(soa.NS)
+
+			// Negative answers are cached for the lesser of the two, per
+			// RFC 2308
+			d.NegativeTTL = min(authority.Header.TTL, soa.MinTTL)
+		}
+	}
+}
+
+// classifyLookupError classifies an error without querying anything further.
+func classifyLookupError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return "timeout"
+		} else if dnsErr.IsNotFound {
+			return "nxdomain"
+		} else if strings.Contains(dnsErr.Err, "SERVFAIL") {
+			return "servfail"
+		} else if strings.Contains(dnsErr.Err, "REFUSED") {
+			return "refused"
+		}
+	}
+	if isTimeout(err) {
+		return "timeout"
+	}
+	return "unknown"
+}
+
+// Hint suggests what to do about the failure.
+func (d *LookupDiagnosis) Hint() string {
+	switch d.Class {
+	case "nxdomain":
+		if d.Zone != "" {
+			return fmt.Sprintf("The name does not exist; check it for typos, or ask the owners of %s (%s) whether the record was removed. Negative answers may be cached for %ds.", d.Zone, d.PrimaryNS, d.NegativeTTL)
+		}
+		return "The name does not exist; check it for typos, or whether the record was removed."
+	case "not_in_search_domains":
+		return fmt.Sprintf("The name was not found as-is or in any search domain (%s); use a fully-qualified name, or check the search list.", strings.Join(d.Search, ", "))
+	case "nodata":
+		return "The name exists, but has no IPv4 addresses; check whether it only has records of another type (such as AAAA or TXT)."
+	case "servfail":
+		return fmt.Sprintf("%s failed to resolve the name; the zone's authoritative nameservers may be unreachable or misconfigured, or DNSSEC validation may have failed.", d.nameserver())
+	case "refused":
+		return fmt.Sprintf("%s refused the query; it may not allow recursive queries from this host, or may not serve this zone.", d.nameserver())
+	case "timeout":
+		return "No response from the nameservers; check that they are up, and that DNS traffic to them (port 53, or 853 and 443 for DNS-over-TLS and DNS-over-HTTPS) is allowed."
+	case "unreachable":
+		return "Unable to reach the nameservers; check that they are up and routable from this host."
+	case "inconsistent":
+		return "The nameservers disagree; check the divergent nameserver for stale records, or changes that have yet to propagate to it."
+	default:
+		return "Check the nameservers configured for this host."
+	}
+}
+
+func (d *LookupDiagnosis) nameserver() string {
+	if d.Nameserver == "" {
+		return "The nameserver"
+	}
+	return fmt.Sprintf("Nameserver %s", d.Nameserver)
+}
+
+// Lines renders the diagnosis for logging, ending with a hint.
+func (d *LookupDiagnosis) Lines() []string {
+	var lines []string
+	if d.Nameserver != "" {
+		lines = append(lines, fmt.Sprintf("DNS diagnosis (%s): %s from %s for %s", d.Class, d.RCode, d.Nameserver, strings.Join(d.Tried, ", ")))
+	} else {
+		lines = append(lines, fmt.Sprintf("DNS diagnosis (%s)", d.Class))
+	}
+
+	if len(d.CNAMEs) > 0 {
+		chain := d.CNAMEs[0].Name
+		for _, hop := range d.CNAMEs {
+			chain += fmt.Sprintf(" -> %s (ttl %ds)", hop.Target, hop.TTL)
+		}
+		lines = append(lines, fmt.Sprintf("CNAME chain: %s", chain))
+	}
+	if d.Addresses > 0 {
+		lines = append(lines, fmt.Sprintf("Answer: %d A record(s), ttl %ds", d.Addresses, d.TTL))
+	}
+	if d.Zone != "" {
+		lines = append(lines, fmt.Sprintf("Authority: zone %s, primary nameserver %s, negative ttl %ds", d.Zone, d.PrimaryNS, d.NegativeTTL))
+	}
+	return append(lines, fmt.Sprintf("Hint: %s", d.Hint()))
+}
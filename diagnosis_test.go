@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestLoadResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	err := os.WriteFile(path, []byte(
+		"# generated\n"+
+			"nameserver 10.0.0.2\n"+
+			"nameserver 10.0.0.3\n"+
+			"search corp.example.com example.com\n"+
+			"options ndots:2 timeout:1\n"), 0644)
+	assertNoError(t, "WriteFile", err)
+
+	got := loadResolvConf(path)
+	if strings.Join(got.Nameservers, ",") != "10.0.0.2,10.0.0.3" || strings.Join(got.Search, ",") != "corp.example.com,example.com" || got.Ndots != 2 {
+		t.Errorf("loadResolvConf = %+v; want 2 nameservers, 2 search domains and ndots 2", got)
+	}
+
+	if got := loadResolvConf(filepath.Join(t.TempDir(), "missing")); len(got.Nameservers) != 0 {
+		t.Errorf("loadResolvConf(missing) = %+v; want the zero value", got)
+	}
+}
+
+func TestClassifyLookupError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{err: &net.DNSError{Err: "no such host", IsNotFound: true}, want: "nxdomain"},
+		{err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}, want: "timeout"},
+		{err: &net.DNSError{Err: "server misbehaving (SERVFAIL)"}, want: "servfail"},
+		{err: &net.DNSError{Err: "server misbehaving (REFUSED)"}, want: "refused"},
+		{err: errors.New("something else"), want: "unknown"},
+	}
+	for _, tc := range cases {
+		if got := classifyLookupError(tc.err); got != tc.want {
+			t.Errorf("classifyLookupError(%v) = %q; want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestDiagnoseLookup(t *testing.T) {
+	server := newTestDNSServer(t,
+		soaRecord("example.test", "ns1.example.test", 3600, 300),
+		cnameRecord("www.example.test", "gone.example.test"),
+		txtRecord("txt.example.test", "hello"),
+		aRecord("app.example.test", "192.0.2.10"))
+	server.setRCode("broken.example.test", dnsmessage.RCodeServerFailure)
+	server.setRCode("refused.example.test", dnsmessage.RCodeRefused)
+
+	r, err := NewResolver(ResolverConfig{Nameservers: []string{server.Addr}, Search: []string{"corp.test"}}, nil)
+	assertNoError(t, "NewResolver", err)
+
+	cases := []struct {
+		host  string
+		class string
+		tried string
+		hint  string
+	}{
+		{host: "missing.example.test", class: "nxdomain", tried: "missing.example.test, missing.example.test.corp.test", hint: "ask the owners of example.test (ns1.example.test)"},
+		{host: "www.example.test", class: "nxdomain", tried: "www.example.test, www.example.test.corp.test", hint: "Negative answers may be cached for 300s"},
+		{host: "txt.example.test", class: "nodata", tried: "txt.example.test", hint: "no IPv4 addresses"},
+		{host: "missing", class: "not_in_search_domains", tried: "missing.corp.test, missing", hint: "search domain (corp.test)"},
+		{host: "broken.example.test", class: "servfail", tried: "broken.example.test", hint: "failed to resolve the name"},
+		{host: "refused.example.test", class: "refused", tried: "refused.example.test", hint: "refused the query"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.host, func(t *testing.T) {
+			_, lookupErr := r.LookupIP(context.Background(), tc.host, 443)
+			if lookupErr == nil {
+				t.Fatalf("LookupIP(%s) succeeded; want an error", tc.host)
+			}
+			d := DiagnoseLookup(context.Background(), r, tc.host, lookupErr)
+			if d.Class != tc.class {
+				t.Errorf("Class = %q; want %q", d.Class, tc.class)
+			}
+			if got := strings.Join(d.Tried, ", "); got != tc.tried {
+				t.Errorf("Tried = %q; want %q", got, tc.tried)
+			}
+			if !strings.Contains(d.Hint(), tc.hint) {
+				t.Errorf("Hint() = %q; want it to contain %q", d.Hint(), tc.hint)
+			}
+		})
+	}
+
+	// The CNAME chain is followed, and its TTLs reported
+	d := DiagnoseLookup(context.Background(), r, "www.example.test", &net.DNSError{IsNotFound: true})
+	if len(d.CNAMEs) != 1 || d.CNAMEs[0] != (DNSHop{Name: "www.example.test", Target: "gone.example.test", TTL: 60}) {
+		t.Errorf("CNAMEs = %+v; want www.example.test -> gone.example.test", d.CNAMEs)
+	}
+	lines := strings.Join(d.Lines(), "\n")
+	for _, want := range []string{
+		"DNS diagnosis (nxdomain): NXDOMAIN from udp://" + server.Addr,
+		"CNAME chain: www.example.test -> gone.example.test (ttl 60s)",
+		"Authority: zone example.test, primary nameserver ns1.example.test, negative ttl 300s",
+		"Hint: ",
+	} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("Lines() = %q; want it to contain %q", lines, want)
+		}
+	}
+
+	// An intermittent failure keeps its class, and the answer's TTL is
+	// reported
+	d = DiagnoseLookup(context.Background(), r, "app.example.test", &net.DNSError{IsTimeout: true})
+	if d.Class != "timeout" || d.Addresses != 1 || d.TTL != 300 {
+		t.Errorf("DiagnoseLookup = %+v; want a timeout, and an address with a TTL of 300s", d)
+	}
+	if lines := strings.Join(d.Lines(), "\n"); !strings.Contains(lines, "Answer: 1 A record(s), ttl 300s") {
+		t.Errorf("Lines() = %q; want the answer's TTL", lines)
+	}
+}
+
+func TestDiagnoseLookupTimeout(t *testing.T) {
+	// A nameserver that never answers
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assertNoError(t, "ListenPacket", err)
+	t.Cleanup(func() { silent.Close() })
+
+	r, err := NewResolver(ResolverConfig{Nameservers: []string{silent.LocalAddr().String()}, Timeout: 50 * time.Millisecond}, nil)
+	assertNoError(t, "NewResolver", err)
+	_, lookupErr := r.LookupIP(context.Background(), "app.example.test", 443)
+	d := DiagnoseLookup(context.Background(), r, "app.example.test", lookupErr)
+	if d.Class != "timeout" || !strings.Contains(d.Hint(), "No response") {
+		t.Errorf("DiagnoseLookup = %+v; want a timeout", d)
+	}
+}
+
+func TestDiagnoseLookupSharesOneTimeout(t *testing.T) {
+	var nameservers []string
+	for i := 0; i < 4; i++ {
+		silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assertNoError(t, "ListenPacket", err)
+		t.Cleanup(func() { silent.Close() })
+		nameservers = append(nameservers, silent.LocalAddr().String())
+	}
+
+	r, err := NewResolver(ResolverConfig{Nameservers: nameservers, Search: []string{"corp.test"}, Timeout: 100 * time.Millisecond}, nil)
+	assertNoError(t, "NewResolver", err)
+	start := time.Now()
+	d := DiagnoseLookup(context.Background(), r, "app", &net.DNSError{IsTimeout: true})
+	if took := time.Since(start); took > 300*time.Millisecond {
+		t.Errorf("DiagnoseLookup took %s; want no more than the 100ms timeout", took)
+	}
+	if d.Class != "timeout" {
+		t.Errorf("Class = %q; want timeout", d.Class)
+	}
+}
+
+func TestLookupFailureIsDiagnosed(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	server := newTestDNSServer(t, soaRecord("example.test", "ns1.example.test", 3600, 300))
+	dest, err := NewDestination(Url{
+		Label:    "missing",
+		Url:      "https://missing.example.test",
+		Resolver: ResolverConfig{Nameservers: []string{server.Addr}}})
+	assertNoError(t, "NewDestination", err)
+
+	if dest.Check() {
+		t.Fatal("Check() = true; want false")
+	}
+	if dest.lookupError != "nxdomain" {
+		t.Errorf("lookupError = %q; want nxdomain", dest.lookupError)
+	}
+
+	var messages []string
+	for len(queue) > 0 {
+		messages = append(messages, recvQueue(t))
+	}
+	all := strings.Join(messages, "\n")
+	for _, want := range []string{"connectivity.lookup.error:", "connectivity.check.error:"} {
+		found := false
+		for _, m := range messages {
+			if strings.HasPrefix(m, want) && strings.Contains(m, "lookup.error:nxdomain") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("enqueued %q; want %s tagged lookup.error:nxdomain", all, want)
+		}
+	}
+
+	_, err = Lookup(dest)
+	var lookupErr *LookupError
+	var dnsErr *net.DNSError
+	if !errors.As(err, &lookupErr) || !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("Lookup error = %#v; want a *LookupError wrapping a not found *net.DNSError", err)
+	}
+}
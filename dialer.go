@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 )
 
 // Try to open a connection to the destination, and then immediately disconnect
@@ -10,11 +12,11 @@ import (
 // validates each individual record in the DNS response.
 func Dial(route *Route, dest *Destination, ip net.IP) bool {
 	metricTags := []string{fmt.Sprintf("dest_ip:%s", ip.String())}
-	hostPort := fmt.Sprintf("%s:%d", ip.String(), dest.Port)
+	hostPort := net.JoinHostPort(ip.String(), strconv.Itoa(dest.Port))
 
 	// Test destination IP by dialing route
 	dest.Increment("connectivity.dial", metricTags)
-	conn, err := net.Dial(dest.Protocol, hostPort)
+	conn, err := dest.dial(context.Background(), dest.Protocol, hostPort)
 	if err != nil {
 		dest.Increment("connectivity.dial.error", metricTags)
 		LogRouteDestinationError(route, dest, "Failed", err)
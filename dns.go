@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSCheck describes the query made by a dns:// destination, and what the
+// response must look like, as parsed from a URL such as:
+//
+//	dns://nameserver[:port]/name?type=MX&expect=10 mail.example.com
+type DNSCheck struct {
+	Name string
+	Type dnsmessage.Type
+
+	// "udp", "tcp", "tls" (DNS-over-TLS) or "https" (DNS-over-HTTPS)
+	Transport string
+
+	// The DNS-over-HTTPS endpoint's path
+	Path string
+
+	// Optional TLS configuration for the tls and https transports
+	TLSConfig *tls.Config
+
+	// The expected response code (NOERROR unless specified)
+	RCode dnsmessage.RCode
+
+	// Values that must each appear among the answers
+	Expect []string
+
+	// The minimum number of answers of the requested type. Defaults to 1 if
+	// the expected response code is NOERROR, and 0 otherwise.
+	MinAnswers int
+}
+
+func ParseDNSCheck(u *url.URL) (*DNSCheck, error) {
+	check := &DNSCheck{
+		Name:      strings.Trim(u.Path, "/"),
+		Type:      dnsmessage.TypeA,
+		Transport: "udp",
+		RCode:     dnsmessage.RCodeSuccess}
+	if check.Name == "" {
+		return nil, errors.New("A name to query is required in the URL path (dns://nameserver/name)")
+	}
+
+	query := u.Query()
+	var err error
+	if t := query.Get("type"); t != "" {
+		if check.Type, err = ParseDNSType(t); err != nil {
+			return nil, err
+		}
+	}
+	if transport := strings.ToLower(query.Get("transport")); transport != "" {
+		if _, ok := dnsPorts[transport]; !ok {
+			return nil, errors.New(fmt.Sprintf("Unsupported DNS transport: %s", transport))
+		}
+		check.Transport = transport
+	}
+	if check.Transport == "https" {
+		check.Path = "/dns-query"
+		if path := query.Get("path"); path != "" {
+			check.Path = "/" + strings.TrimPrefix(path, "/")
+		}
+	}
+	if r := query.Get("rcode"); r != "" {
+		if check.RCode, err = ParseDNSRCode(r); err != nil {
+			return nil, err
+		}
+	}
+	for _, expect := range query["expect"] {
+		for _, value := range strings.Split(expect, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				check.Expect = append(check.Expect, normalizeDNSValue(value))
+			}
+		}
+	}
+
+	if check.RCode == dnsmessage.RCodeSuccess {
+		check.MinAnswers = 1
+	}
+	if min := query.Get("min_answers"); min != "" {
+		if check.MinAnswers, err = strconv.Atoi(min); err != nil || check.MinAnswers < 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid min_answers: %s", min))
+		}
+	}
+
+	return check, nil
+}
+
+func normalizeDNSValue(s string) string {
+	return strings.ToLower(strings.TrimSuffix(s, "."))
+}
+
+// Answers returns the formatted answers in a response that match the
+// requested record type, ignoring anything else (such as the CNAME records
+// leading to an A record).
+func (c *DNSCheck) Answers(msg *dnsmessage.Message) []string {
+	var answers []string
+	for _, answer := range msg.Answers {
+		if answer.Header.Type == c.Type {
+			answers = append(answers, FormatDNSResource(answer.Body))
+		}
+	}
+	return answers
+}
+
+// Evaluate returns an error describing the first way in which the response
+// does not meet expectations.
+func (c *DNSCheck) Evaluate(msg *dnsmessage.Message) error {
+	if msg.Header.RCode != c.RCode {
+		return errors.New(fmt.Sprintf("Response code %s; want %s", DNSRCodeString(msg.Header.RCode), DNSRCodeString(c.RCode)))
+	}
+
+	answers := c.Answers(msg)
+	if len(answers) < c.MinAnswers {
+		return errors.New(fmt.Sprintf("%d %s answers; want at least %d", len(answers), DNSTypeString(c.Type), c.MinAnswers))
+	}
+
+	for _, want := range c.Expect {
+		if !dnsAnswersContain(answers, want) {
+			return errors.New(fmt.Sprintf("No %s answer matching %q in [%s]", DNSTypeString(c.Type), want, strings.Join(answers, ", ")))
+		}
+	}
+	return nil
+}
+
+// dnsAnswersContain matches an expected value against either an entire
+// answer (such as "10 mail.example.com") or just its final field (such as
+// "mail.example.com"), so that MX and SRV targets can be asserted on alone.
+func dnsAnswersContain(answers []string, want string) bool {
+	for _, answer := range answers {
+		answer = normalizeDNSValue(answer)
+		fields := strings.Fields(answer)
+		if answer == want || (len(fields) > 1 && fields[len(fields)-1] == want) {
+			return true
+		}
+	}
+	return false
+}
+
+// nameserver returns the server that a dns:// destination queries.
+func (dest *Destination) nameserver() Nameserver {
+	ns := Nameserver{
+		Address:   dest.HostPort(),
+		Transport: dest.DNS.Transport,
+		TLSConfig: dest.DNS.TLSConfig,
+		Dial:      dest.dial}
+	if ns.Transport == "https" {
+		ns.URL = (&url.URL{Scheme: "https", Host: ns.Address, Path: dest.DNS.Path}).String()
+	}
+	return ns
+}
+
+// Queries the destination's nameserver directly and validates the response.
+func DNS(dest *Destination) bool {
+	metricTags := []string{
+		fmt.Sprintf("query_type:%s", DNSTypeString(dest.DNS.Type)),
+		fmt.Sprintf("transport:%s", dest.DNS.Transport)}
+	ns := dest.nameserver()
+
+	dest.Increment("connectivity.dns", metricTags)
+	query, err := NewDNSQuery(dest.DNS.Name, dest.DNS.Type)
+	if err != nil {
+		dest.Increment("connectivity.dns.error", metricTags)
+		LogDestinationError(dest, fmt.Sprintf("Failed to build query for %s", dest.DNS.Name), err)
+		return false
+	}
+
+	t1 := time.Now()
+	response, err := ns.Exchange(context.Background(), query)
+	dest.Timer("connectivity.dns", time.Since(t1), metricTags)
+	if err != nil {
+		dest.Increment("connectivity.dns.error", metricTags)
+		LogDestinationError(dest, fmt.Sprintf("Failed to query %s for %s %s", ns, DNSTypeString(dest.DNS.Type), dest.DNS.Name), err)
+		return false
+	}
+
+	if err := dest.DNS.Evaluate(response); err != nil {
+		dest.Increment("connectivity.dns.error", metricTags)
+		LogDestinationError(dest, fmt.Sprintf("Unexpected response from %s for %s %s", ns, DNSTypeString(dest.DNS.Type), dest.DNS.Name), err)
+		return false
+	}
+
+	dest.Increment("connectivity.dns.success", metricTags)
+	return true
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSServer is an in-process nameserver answering over both UDP and TCP
+// on the same loopback port, from a fixed set of records. Names without any
+// records get NXDOMAIN, and CNAMEs are followed within the zone.
+type testDNSServer struct {
+	Addr string
+	Port int
+
+	mu      sync.Mutex
+	records []dnsmessage.Resource
+	rcodes  map[string]dnsmessage.RCode
+
+	// If set, UDP responses are truncated to force a retry over TCP
+	truncateUDP bool
+
+	// The transports of the queries received, in order
+	transports []string
+
+	udp net.PacketConn
+	tcp net.Listener
+}
+
+func newTestDNSServer(t *testing.T, records ...dnsmessage.Resource) *testDNSServer {
+	t.Helper()
+	s := &testDNSServer{records: records, rcodes: map[string]dnsmessage.RCode{}}
+
+	// Find a port that's free for both UDP and TCP
+	for attempt := 0; ; attempt++ {
+		udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("ListenPacket: %v", err)
+		}
+		tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+		if err == nil {
+			s.udp, s.tcp = udp, tcp
+			break
+		}
+		udp.Close()
+		if attempt == 10 {
+			t.Fatalf("Listen: %v", err)
+		}
+	}
+	s.Addr = s.udp.LocalAddr().String()
+	s.Port = s.udp.LocalAddr().(*net.UDPAddr).Port
+	t.Cleanup(func() {
+		s.udp.Close()
+		s.tcp.Close()
+	})
+
+	go s.serveUDP()
+	go s.serveStream(s.tcp, "tcp")
+	return s
+}
+
+// serveEncrypted additionally serves the zone over DNS-over-TLS and
+// DNS-over-HTTPS (at /dns-query), returning their addresses and tls options
+// trusting their certificate.
+func (s *testDNSServer) serveEncrypted(t *testing.T) (string, string, TLSOptions) {
+	t.Helper()
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns-query" || r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		query, err := io.ReadAll(r.Body)
+		response := s.handle(query, "https")
+		if err != nil || response == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(response)
+	}))
+	t.Cleanup(doh.Close)
+
+	dot, err := tls.Listen("tcp", "127.0.0.1:0", doh.TLS.Clone())
+	if err != nil {
+		t.Fatalf("tls.Listen: %v", err)
+	}
+	t.Cleanup(func() { dot.Close() })
+	go s.serveStream(dot, "tls")
+
+	return dot.Addr().String(), doh.Listener.Addr().String(), testTLSOptions(t, doh.TLS)
+}
+
+// setRCode makes the server answer queries for name (or every name, if name
+// is "*") with rcode.
+func (s *testDNSServer) setRCode(name string, rcode dnsmessage.RCode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rcodes[strings.ToLower(name)] = rcode
+}
+
+// setRecords replaces the records the server answers from.
+func (s *testDNSServer) setRecords(records ...dnsmessage.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = records
+}
+
+func (s *testDNSServer) queryTransports() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.transports...)
+}
+
+func (s *testDNSServer) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if response := s.handle(buf[:n], "udp"); response != nil {
+			s.udp.WriteTo(response, addr)
+		}
+	}
+}
+
+// serveStream answers length-prefixed queries, as sent over TCP and TLS.
+func (s *testDNSServer) serveStream(l net.Listener, transport string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var length uint16
+			if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+				return
+			}
+			query := make([]byte, length)
+			if _, err := io.ReadFull(conn, query); err != nil {
+				return
+			}
+			response := s.handle(query, transport)
+			binary.Write(conn, binary.BigEndian, uint16(len(response)))
+			conn.Write(response)
+		}()
+	}
+}
+
+func (s *testDNSServer) handle(packed []byte, transport string) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(packed); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transports = append(s.transports, transport)
+
+	q := query.Questions[0]
+	response := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.Header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   query.Header.RecursionDesired,
+			RecursionAvailable: true},
+		Questions: query.Questions}
+
+	name := strings.ToLower(q.Name.String())
+	if rcode, ok := s.rcodes[strings.TrimSuffix(name, ".")]; ok {
+		response.Header.RCode = rcode
+	} else if rcode, ok := s.rcodes["*"]; ok {
+		response.Header.RCode = rcode
+	} else if s.truncateUDP && transport == "udp" {
+		response.Header.Truncated = true
+	} else {
+		response.Answers = s.resolve(name, q.Type)
+
+		// The response code describes the end of any CNAME chain
+		final := name
+		if n := len(response.Answers); n > 0 && response.Answers[n-1].Header.Type == dnsmessage.TypeCNAME {
+			final = strings.ToLower(response.Answers[n-1].Body.(*dnsmessage.CNAMEResource).CNAME.String())
+		}
+		if !s.exists(final) {
+			response.Header.RCode = dnsmessage.RCodeNameError
+		}
+		if final != name || len(response.Answers) == 0 {
+			response.Authorities = s.authority(final)
+		}
+	}
+
+	out, err := response.Pack()
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// authority returns the SOA record of the zone containing name, if any, as
+// included with negative answers.
+func (s *testDNSServer) authority(name string) []dnsmessage.Resource {
+	for _, r := range s.records {
+		zone := strings.ToLower(r.Header.Name.String())
+		if r.Header.Type == dnsmessage.TypeSOA && (name == zone || strings.HasSuffix(name, "."+zone)) {
+			return []dnsmessage.Resource{r}
+		}
+	}
+	return nil
+}
+
+func (s *testDNSServer) exists(name string) bool {
+	for _, r := range s.records {
+		if strings.ToLower(r.Header.Name.String()) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testDNSServer) resolve(name string, qtype dnsmessage.Type) []dnsmessage.Resource {
+	var answers []dnsmessage.Resource
+	for _, r := range s.records {
+		if strings.ToLower(r.Header.Name.String()) != name {
+			continue
+		}
+		if r.Header.Type == qtype {
+			answers = append(answers, r)
+		} else if r.Header.Type == dnsmessage.TypeCNAME {
+			target := strings.ToLower(r.Body.(*dnsmessage.CNAMEResource).CNAME.String())
+			answers = append(answers, r)
+			answers = append(answers, s.resolve(target, qtype)...)
+		}
+	}
+	return answers
+}
+
+func dnsName(name string) dnsmessage.Name {
+	return dnsmessage.MustNewName(strings.TrimSuffix(name, ".") + ".")
+}
+
+func dnsHeader(name string, qtype dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsName(name), Type: qtype, Class: dnsmessage.ClassINET, TTL: ttl}
+}
+
+func aRecord(name string, ip string) dnsmessage.Resource {
+	var a [4]byte
+	copy(a[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeA, 300), Body: &dnsmessage.AResource{A: a}}
+}
+
+func aaaaRecord(name string, ip string) dnsmessage.Resource {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(ip).To16())
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeAAAA, 300), Body: &dnsmessage.AAAAResource{AAAA: aaaa}}
+}
+
+func cnameRecord(name string, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeCNAME, 60), Body: &dnsmessage.CNAMEResource{CNAME: dnsName(target)}}
+}
+
+func mxRecord(name string, pref uint16, mx string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeMX, 300), Body: &dnsmessage.MXResource{Pref: pref, MX: dnsName(mx)}}
+}
+
+func txtRecord(name string, txt ...string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeTXT, 300), Body: &dnsmessage.TXTResource{TXT: txt}}
+}
+
+func srvRecord(name string, priority uint16, weight uint16, port uint16, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(name, dnsmessage.TypeSRV, 300), Body: &dnsmessage.SRVResource{Priority: priority, Weight: weight, Port: port, Target: dnsName(target)}}
+}
+
+func soaRecord(zone string, ns string, ttl uint32, minTTL uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsHeader(zone, dnsmessage.TypeSOA, ttl), Body: &dnsmessage.SOAResource{NS: dnsName(ns), MBox: dnsName("hostmaster." + zone), Serial: 1, Refresh: 3600, Retry: 600, Expire: 86400, MinTTL: minTTL}}
+}
+
+// testZone is a small zone shared by the DNS tests.
+func testZone() []dnsmessage.Resource {
+	return []dnsmessage.Resource{
+		aRecord("example.test", "192.0.2.10"),
+		aRecord("example.test", "192.0.2.11"),
+		aaaaRecord("example.test", "2001:db8::10"),
+		cnameRecord("www.example.test", "example.test"),
+		mxRecord("example.test", 10, "mail.example.test"),
+		txtRecord("example.test", "v=spf1 ", "-all"),
+		srvRecord("_ldap._tcp.example.test", 0, 100, 389, "ldap.example.test"),
+	}
+}
+
+func newDNSDestination(t *testing.T, server *testDNSServer, pathAndQuery string) *Destination {
+	t.Helper()
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+	u := fmt.Sprintf("dns://%s%s", server.Addr, pathAndQuery)
+	dest, err := NewDestination(Url{Label: "dns", Url: u})
+	if err != nil {
+		t.Fatalf("NewDestination(%s): %v", u, err)
+	}
+	return dest
+}
+
+func TestDNSUrlDefaults(t *testing.T) {
+	got, err := NewDestination(Url{Label: "dns", Url: "dns://192.0.2.53/example.com"})
+	assertNoError(t, "dns://192.0.2.53/example.com", err)
+	assertSchemeEquals(t, got.Scheme, "dns")
+	assertHostEquals(t, got.Host, "192.0.2.53")
+	assertPortEquals(t, got.Port, 53)
+	if got.Protocol != "udp" {
+		t.Errorf("Protocol = %q; want %q", got.Protocol, "udp")
+	}
+	if got.DNS.Name != "example.com" || got.DNS.Type != dnsmessage.TypeA || got.DNS.RCode != dnsmessage.RCodeSuccess || got.DNS.MinAnswers != 1 {
+		t.Errorf("DNS = %+v; want an A query for example.com expecting NOERROR and an answer", got.DNS)
+	}
+}
+
+func TestDNSUrlOptions(t *testing.T) {
+	got, err := NewDestination(Url{Label: "dns", Url: "dns://192.0.2.53:5353/example.com?type=mx&transport=tcp&expect=Mail.Example.com.,backup.example.com&min_answers=2"})
+	assertNoError(t, "dns:// with options", err)
+	assertPortEquals(t, got.Port, 5353)
+	if got.Protocol != "tcp" {
+		t.Errorf("Protocol = %q; want %q", got.Protocol, "tcp")
+	}
+	if got.DNS.Type != dnsmessage.TypeMX || got.DNS.MinAnswers != 2 {
+		t.Errorf("DNS = %+v; want an MX query expecting 2 answers", got.DNS)
+	}
+	if strings.Join(got.DNS.Expect, " ") != "mail.example.com backup.example.com" {
+		t.Errorf("DNS.Expect = %q; want normalized values", got.DNS.Expect)
+	}
+
+	got, err = NewDestination(Url{Label: "dns", Url: "dns://192.0.2.53/missing.example.com?rcode=nxdomain"})
+	assertNoError(t, "dns:// expecting NXDOMAIN", err)
+	if got.DNS.RCode != dnsmessage.RCodeNameError || got.DNS.MinAnswers != 0 {
+		t.Errorf("DNS = %+v; want NXDOMAIN expecting no answers", got.DNS)
+	}
+}
+
+func TestDNSUrlErrors(t *testing.T) {
+	cases := []struct {
+		url    string
+		substr string
+	}{
+		{url: "dns://192.0.2.53", substr: "name to query is required"},
+		{url: "dns://192.0.2.53/example.com?type=BOGUS", substr: "Unsupported DNS record type"},
+		{url: "dns://192.0.2.53/example.com?rcode=BOGUS", substr: "Unsupported DNS response code"},
+		{url: "dns://192.0.2.53/example.com?transport=sctp", substr: "Unsupported DNS transport"},
+		{url: "dns://192.0.2.53/example.com?min_answers=-1", substr: "Invalid min_answers"},
+	}
+	for _, tc := range cases {
+		_, err := NewDestination(Url{Label: "dns", Url: tc.url})
+		assertErrorContains(t, err, tc.substr)
+	}
+}
+
+func TestDNSCheck_Evaluate(t *testing.T) {
+	server := newTestDNSServer(t, testZone()...)
+	server.setRCode("broken.example.test", dnsmessage.RCodeServerFailure)
+
+	cases := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{name: "a_records", path: "/example.test?expect=192.0.2.10,192.0.2.11&min_answers=2", want: true},
+		{name: "a_record_missing", path: "/example.test?expect=192.0.2.99", want: false},
+		{name: "too_few_answers", path: "/example.test?min_answers=3", want: false},
+		{name: "aaaa_record", path: "/example.test?type=AAAA&expect=2001:db8::10", want: true},
+		{name: "cname_followed", path: "/www.example.test?expect=192.0.2.10", want: true},
+		{name: "cname_record", path: "/www.example.test?type=CNAME&expect=example.test", want: true},
+		{name: "mx_target", path: "/example.test?type=MX&expect=mail.example.test", want: true},
+		{name: "mx_with_preference", path: "/example.test?type=MX&expect=10 mail.example.test", want: true},
+		{name: "mx_wrong_preference", path: "/example.test?type=MX&expect=20 mail.example.test", want: false},
+		{name: "txt_joined", path: "/example.test?type=TXT&expect=v=spf1 -all", want: true},
+		{name: "srv_target", path: "/_ldap._tcp.example.test?type=SRV&expect=ldap.example.test", want: true},
+		{name: "nxdomain_unexpected", path: "/missing.example.test", want: false},
+		{name: "nxdomain_expected", path: "/missing.example.test?rcode=NXDOMAIN", want: true},
+		{name: "nodata", path: "/example.test?type=SRV", want: false},
+		{name: "nodata_allowed", path: "/example.test?type=SRV&min_answers=0", want: true},
+		{name: "servfail", path: "/broken.example.test", want: false},
+		{name: "servfail_expected", path: "/broken.example.test?rcode=SERVFAIL", want: true},
+		{name: "over_tcp", path: "/example.test?transport=tcp", want: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := newDNSDestination(t, server, tc.path)
+			if got := DNS(dest); got != tc.want {
+				t.Errorf("DNS(%s) = %v; want %v", dest.URL, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNameserver_TruncatedResponseRetriesOverTCP(t *testing.T) {
+	server := newTestDNSServer(t, testZone()...)
+	server.mu.Lock()
+	server.truncateUDP = true
+	server.mu.Unlock()
+
+	query, err := NewDNSQuery("example.test", dnsmessage.TypeA)
+	assertNoError(t, "NewDNSQuery", err)
+	response, err := Nameserver{Address: server.Addr, Transport: "udp"}.Exchange(context.Background(), query)
+	assertNoError(t, "Exchange", err)
+	if response != nil && len(response.Answers) != 2 {
+		t.Errorf("len(Answers) = %d; want 2", len(response.Answers))
+	}
+	if got := strings.Join(server.queryTransports(), ","); got != "udp,tcp" {
+		t.Errorf("query transports = %s; want udp,tcp", got)
+	}
+}
+
+func TestParseNameserver(t *testing.T) {
+	cases := []struct {
+		in        string
+		transport string
+		want      Nameserver
+	}{
+		{in: "192.0.2.53", transport: "udp", want: Nameserver{Address: "192.0.2.53:53", Transport: "udp"}},
+		{in: "[2001:db8::53]", transport: "tcp", want: Nameserver{Address: "[2001:db8::53]:53", Transport: "tcp"}},
+		{in: "192.0.2.53", transport: "tls", want: Nameserver{Address: "192.0.2.53:853", Transport: "tls"}},
+		{in: "tls://1.1.1.1", transport: "udp", want: Nameserver{Address: "1.1.1.1:853", Transport: "tls"}},
+		{in: "tcp://192.0.2.53:5353", transport: "udp", want: Nameserver{Address: "192.0.2.53:5353", Transport: "tcp"}},
+		{in: "https://dns.example/dns-query", transport: "udp", want: Nameserver{Address: "dns.example:443", Transport: "https", URL: "https://dns.example/dns-query"}},
+		{in: "https://dns.example:8443", transport: "udp", want: Nameserver{Address: "dns.example:8443", Transport: "https", URL: "https://dns.example:8443/dns-query"}},
+	}
+	for _, tc := range cases {
+		got, err := ParseNameserver(tc.in, tc.transport)
+		assertNoError(t, tc.in, err)
+		if got.Address != tc.want.Address || got.Transport != tc.want.Transport || got.URL != tc.want.URL {
+			t.Errorf("ParseNameserver(%s, %s) = %+v; want %+v", tc.in, tc.transport, got, tc.want)
+		}
+	}
+
+	_, err := ParseNameserver("quic://192.0.2.53", "udp")
+	assertErrorContains(t, err, "Unsupported DNS transport")
+	_, err = ParseNameserver("https:///dns-query", "udp")
+	assertErrorContains(t, err, "Invalid nameserver")
+}
+
+func TestNameserver_EncryptedTransports(t *testing.T) {
+	server := newTestDNSServer(t, testZone()...)
+	dotAddr, dohAddr, options := server.serveEncrypted(t)
+	config, err := NewTLSConfig(options)
+	assertNoError(t, "NewTLSConfig", err)
+
+	nameservers := []Nameserver{
+		{Address: dotAddr, Transport: "tls", TLSConfig: config},
+		{Address: dohAddr, Transport: "https", URL: fmt.Sprintf("https://%s/dns-query", dohAddr), TLSConfig: config},
+	}
+	for _, ns := range nameservers {
+		query, err := NewDNSQuery("example.test", dnsmessage.TypeA)
+		assertNoError(t, "NewDNSQuery", err)
+		response, err := ns.Exchange(context.Background(), query)
+		assertNoError(t, ns.String(), err)
+		if response != nil && len(response.Answers) != 2 {
+			t.Errorf("%s: len(Answers) = %d; want 2", ns, len(response.Answers))
+		}
+	}
+	if got := strings.Join(server.queryTransports(), ","); got != "tls,https" {
+		t.Errorf("query transports = %s; want tls,https", got)
+	}
+
+	// Without trusting the test certificate, both must fail
+	for _, ns := range nameservers {
+		ns.TLSConfig = nil
+		query, _ := NewDNSQuery("example.test", dnsmessage.TypeA)
+		if _, err := ns.Exchange(context.Background(), query); err == nil {
+			t.Errorf("%s: Exchange with an untrusted certificate succeeded; want an error", ns)
+		}
+	}
+}
+
+func TestDNSUrlEncryptedTransports(t *testing.T) {
+	got, err := NewDestination(Url{Label: "dns", Url: "dns://1.1.1.1/example.com?transport=tls"})
+	assertNoError(t, "dns:// over tls", err)
+	assertPortEquals(t, got.Port, 853)
+	if got.Protocol != "tcp" {
+		t.Errorf("Protocol = %q; want %q", got.Protocol, "tcp")
+	}
+
+	got, err = NewDestination(Url{Label: "dns", Url: "dns://dns.example/example.com?transport=https"})
+	assertNoError(t, "dns:// over https", err)
+	assertPortEquals(t, got.Port, 443)
+	if ns := got.nameserver(); ns.URL != "https://dns.example:443/dns-query" {
+		t.Errorf("nameserver URL = %q; want the default DoH path", ns.URL)
+	}
+
+	got, err = NewDestination(Url{Label: "dns", Url: "dns://dns.example:8443/example.com?transport=https&path=resolve"})
+	assertNoError(t, "dns:// over https with a path", err)
+	if ns := got.nameserver(); ns.URL != "https://dns.example:8443/resolve" {
+		t.Errorf("nameserver URL = %q; want https://dns.example:8443/resolve", ns.URL)
+	}
+}
+
+func TestDNSCheckOverEncryptedTransports(t *testing.T) {
+	server := newTestDNSServer(t, testZone()...)
+	dotAddr, dohAddr, config := server.serveEncrypted(t)
+
+	for transport, addr := range map[string]string{"tls": dotAddr, "https": dohAddr} {
+		t.Run(transport, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			u := fmt.Sprintf("dns://%s/example.test?transport=%s&expect=192.0.2.10", addr, transport)
+			dest, err := NewDestination(Url{Label: "dns", Url: u, TLS: config})
+			assertNoError(t, u, err)
+			if !DNS(dest) {
+				t.Errorf("DNS(%s) = false; want true", u)
+			}
+
+			// The query latency is reported per transport
+			recvQueue(t)
+			if got := recvQueue(t); !strings.HasPrefix(got, "connectivity.dns:") || !strings.Contains(got, "transport:"+transport) {
+				t.Errorf("enqueued %q; want a connectivity.dns timer tagged transport:%s", got, transport)
+			}
+		})
+	}
+}
+
+func TestDNSCheckThroughCheck(t *testing.T) {
+	server := newTestDNSServer(t, testZone()...)
+	dest := newDNSDestination(t, server, "/example.test?expect=192.0.2.10")
+	if !dest.Check() {
+		t.Errorf("Check(%s) = false; want true", dest.URL)
+	}
+}
+
+func TestFormatDNSResource(t *testing.T) {
+	cases := []struct {
+		record dnsmessage.Resource
+		want   string
+	}{
+		{record: aRecord("a.test", "192.0.2.1"), want: "192.0.2.1"},
+		{record: aaaaRecord("a.test", "2001:db8::1"), want: "2001:db8::1"},
+		{record: cnameRecord("a.test", "B.test"), want: "b.test"},
+		{record: mxRecord("a.test", 5, "mx.test"), want: "5 mx.test"},
+		{record: txtRecord("a.test", "hello ", "world"), want: "hello world"},
+		{record: srvRecord("_x._tcp.a.test", 1, 2, 3, "t.test"), want: "1 2 3 t.test"},
+	}
+	for _, tc := range cases {
+		if got := FormatDNSResource(tc.record.Body); got != tc.want {
+			t.Errorf("FormatDNSResource(%s) = %q; want %q", tc.record.Header.Type, got, tc.want)
+		}
+	}
+}
+
+func TestParseDNSCheckFromURL(t *testing.T) {
+	u, _ := url.Parse("dns://192.0.2.53/example.com?expect=a&expect=b,c")
+	check, err := ParseDNSCheck(u)
+	assertNoError(t, "ParseDNSCheck", err)
+	if got := strings.Join(check.Expect, ","); got != "a,b,c" {
+		t.Errorf("Expect = %s; want a,b,c", got)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+
+This module is a minimal DNS client, used to query specific nameservers
+directly rather than going through the operating system's resolver.
+
+*/
+
+const DefaultDNSTimeout = 5 * time.Second
+
+// Nameserver is a DNS server to send queries to.
+type Nameserver struct {
+	// host:port
+	Address string
+
+	// "udp", "tcp", "tls" (DNS-over-TLS) or "https" (DNS-over-HTTPS).
+	// Queries over UDP are retried over TCP if the response is truncated.
+	Transport string
+
+	// The DNS-over-HTTPS endpoint, such as https://dns.example/dns-query
+	URL string
+
+	// Optional TLS configuration for the tls and https transports
+	TLSConfig *tls.Config
+
+	// Optionally dials connections to the nameserver (such as through a
+	// destination's proxy), instead of dialing directly
+	Dial func(ctx context.Context, network string, address string) (net.Conn, error)
+}
+
+func (ns Nameserver) String() string {
+	if ns.Transport == "https" {
+		return ns.URL
+	}
+	return fmt.Sprintf("%s://%s", ns.Transport, ns.Address)
+}
+
+// The default ports for each DNS transport
+var dnsPorts = map[string]string{
+	"udp":   "53",
+	"tcp":   "53",
+	"tls":   "853",
+	"https": "443",
+}
+
+// ParseNameserver parses a nameserver, given as host[:port] (queried using
+// the default transport), or as a URL such as tcp://host[:port],
+// tls://host[:port] or https://host[:port]/dns-query.
+func ParseNameserver(s string, transport string) (Nameserver, error) {
+	if scheme, rest, found := strings.Cut(s, "://"); found {
+		transport = strings.ToLower(scheme)
+		if transport == "https" {
+			u, err := url.Parse(s)
+			if err != nil || u.Hostname() == "" {
+				return Nameserver{}, errors.New(fmt.Sprintf("Invalid nameserver: %s", s))
+			}
+			port := u.Port()
+			if port == "" {
+				port = dnsPorts["https"]
+			}
+			if u.Path == "" {
+				u.Path = "/dns-query"
+			}
+			return Nameserver{Address: net.JoinHostPort(u.Hostname(), port), Transport: transport, URL: u.String()}, nil
+		}
+		s = rest
+	}
+
+	defaultPort, ok := dnsPorts[transport]
+	if !ok {
+		return Nameserver{}, errors.New(fmt.Sprintf("Unsupported DNS transport: %s", transport))
+	}
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		s = net.JoinHostPort(strings.Trim(s, "[]"), defaultPort)
+	}
+	host, _, err := net.SplitHostPort(s)
+	if err != nil || host == "" {
+		return Nameserver{}, errors.New(fmt.Sprintf("Invalid nameserver: %s", s))
+	}
+	return Nameserver{Address: s, Transport: transport}, nil
+}
+
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"NS":    dnsmessage.TypeNS,
+	"PTR":   dnsmessage.TypePTR,
+	"SOA":   dnsmessage.TypeSOA,
+	"SRV":   dnsmessage.TypeSRV,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+var dnsRCodes = map[string]dnsmessage.RCode{
+	"NOERROR":  dnsmessage.RCodeSuccess,
+	"FORMERR":  dnsmessage.RCodeFormatError,
+	"SERVFAIL": dnsmessage.RCodeServerFailure,
+	"NXDOMAIN": dnsmessage.RCodeNameError,
+	"NOTIMP":   dnsmessage.RCodeNotImplemented,
+	"REFUSED":  dnsmessage.RCodeRefused,
+}
+
+func ParseDNSType(s string) (dnsmessage.Type, error) {
+	if t, ok := dnsTypes[strings.ToUpper(s)]; ok {
+		return t, nil
+	}
+	return 0, errors.New(fmt.Sprintf("Unsupported DNS record type: %s", s))
+}
+
+func ParseDNSRCode(s string) (dnsmessage.RCode, error) {
+	if r, ok := dnsRCodes[strings.ToUpper(s)]; ok {
+		return r, nil
+	}
+	return 0, errors.New(fmt.Sprintf("Unsupported DNS response code: %s", s))
+}
+
+func DNSTypeString(t dnsmessage.Type) string {
+	for name, value := range dnsTypes {
+		if value == t {
+			return name
+		}
+	}
+	return t.String()
+}
+
+func DNSRCodeString(r dnsmessage.RCode) string {
+	for name, value := range dnsRCodes {
+		if value == r {
+			return name
+		}
+	}
+	return r.String()
+}
+
+// NewDNSQuery builds a recursive query for a single question.
+func NewDNSQuery(name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               uint16(rand.Intn(1 << 16)),
+			RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  qname,
+			Type:  qtype,
+			Class: dnsmessage.ClassINET}}}, nil
+}
+
+// Exchange sends a query to the nameserver and returns its response.
+func (ns Nameserver) Exchange(ctx context.Context, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultDNSTimeout)
+		defer cancel()
+	}
+
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := ns.Transport
+	if transport == "" {
+		transport = "udp"
+	}
+
+	dial := ns.Dial
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+
+	var response []byte
+	switch transport {
+	case "udp":
+		response, err = exchangeUDP(ctx, dial, ns.Address, packed)
+	case "tcp":
+		response, err = exchangeTCP(ctx, dial, ns.Address, packed)
+	case "tls":
+		response, err = exchangeTLS(ctx, dial, ns.Address, ns.tlsConfig(), packed)
+	case "https":
+		response, err = exchangeHTTPS(ctx, dial, ns.URL, ns.tlsConfig(), packed)
+	default:
+		err = errors.New(fmt.Sprintf("Unsupported DNS transport: %s", transport))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(response); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse DNS response from %s: %v", ns, err))
+	}
+	if msg.Header.ID != query.Header.ID {
+		return nil, errors.New(fmt.Sprintf("Mismatched DNS response ID from %s", ns))
+	}
+
+	// Retry truncated responses over TCP, which has no size limit
+	if msg.Header.Truncated && transport == "udp" {
+		retry := ns
+		retry.Transport = "tcp"
+		return retry.Exchange(ctx, query)
+	}
+	return &msg, nil
+}
+
+// dialFunc dials a connection, as net.Dialer.DialContext does.
+type dialFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+func dialDNS(ctx context.Context, dial dialFunc, network string, address string) (net.Conn, error) {
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+func exchangeUDP(ctx context.Context, dial dialFunc, address string, packed []byte) ([]byte, error) {
+	conn, err := dialDNS(ctx, dial, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func exchangeTCP(ctx context.Context, dial dialFunc, address string, packed []byte) ([]byte, error) {
+	conn, err := dialDNS(ctx, dial, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return exchangeStream(conn, packed)
+}
+
+func (ns Nameserver) tlsConfig() *tls.Config {
+	if ns.TLSConfig != nil {
+		return ns.TLSConfig.Clone()
+	}
+	return &tls.Config{}
+}
+
+func exchangeTLS(ctx context.Context, dial dialFunc, address string, config *tls.Config, packed []byte) ([]byte, error) {
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	conn, err := dialDNS(ctx, dial, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return exchangeStream(tlsConn, packed)
+}
+
+// exchangeHTTPS sends a query using DNS-over-HTTPS, per RFC 8484.
+func exchangeHTTPS(ctx context.Context, dial dialFunc, endpoint string, config *tls.Config, packed []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dial
+	transport.TLSClientConfig = config
+
+	// Like every other stage, queries take the nameserver's dialer rather
+	// than a proxy from the environment
+	transport.Proxy = nil
+	transport.DisableKeepAlives = true
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("DNS-over-HTTPS request failed: %s", resp.Status))
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
+
+// exchangeStream writes a length-prefixed query to a stream (TCP or TLS) and
+// reads a length-prefixed response.
+func exchangeStream(conn io.ReadWriter, packed []byte) ([]byte, error) {
+	buf := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(buf, uint16(len(packed)))
+	copy(buf[2:], packed)
+	if _, err := conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// FormatDNSResource renders the data of a resource record the way it would
+// appear in a zone file (without the owner name, TTL or type), so it can be
+// compared against expectations and logged.
+func FormatDNSResource(body dnsmessage.ResourceBody) string {
+	switch r := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(r.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(r.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		return formatDNSName(r.CNAME)
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", r.Pref, formatDNSName(r.MX))
+	case *dnsmessage.NSResource:
+		return formatDNSName(r.NS)
+	case *dnsmessage.PTRResource:
+		return formatDNSName(r.PTR)
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s %d", formatDNSName(r.NS), formatDNSName(r.MBox), r.Serial)
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, formatDNSName(r.Target))
+	case *dnsmessage.TXTResource:
+		return strings.Join(r.TXT, "")
+	default:
+		return body.GoString()
+	}
+}
+
+func formatDNSName(name dnsmessage.Name) string {
+	return strings.ToLower(strings.TrimSuffix(name.String(), "."))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+const DefaultGRPCTimeout = 5 * time.Second
+
+// GRPCCheck describes the health check made by a grpc:// or grpcs://
+// destination, as parsed from a URL such as:
+//
+//	grpcs://host:port/package.Service
+type GRPCCheck struct {
+	// The service to check, or "" for the server as a whole
+	Service string
+}
+
+// IsGRPC reports whether a scheme is checked by GRPCCheck.
+func IsGRPC(scheme string) bool {
+	return scheme == "grpc" || scheme == "grpcs"
+}
+
+// ParseGRPCCheck parses the path of a grpc:// or grpcs:// URL.
+func ParseGRPCCheck(u *url.URL) (*GRPCCheck, error) {
+	service := strings.Trim(u.Path, "/")
+	if strings.Contains(service, "/") {
+		return nil, errors.New(fmt.Sprintf("Invalid service name: %s", service))
+	}
+	return &GRPCCheck{Service: service}, nil
+}
+
+// healthCheck calls grpc.health.v1.Health/Check, which must report that the
+// service is SERVING.
+func (c *GRPCCheck) healthCheck(dest *Destination) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultGRPCTimeout)
+	defer cancel()
+
+	creds := insecure.NewCredentials()
+	if dest.Scheme == "grpcs" {
+		creds = credentials.NewTLS(dest.tlsConfig())
+	}
+
+	// Resolve the host the same way as the rest of the destination's checks,
+	// rather than with gRPC's own resolver
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("passthrough:///%s", dest.HostPort()),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			return dest.DialContext(ctx, "tcp", address)
+		}))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var p peer.Peer
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: c.Service}, grpc.Peer(&p))
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		InspectTLS(dest, tlsInfo.State)
+	}
+	if err != nil {
+		return err
+	}
+	if response.Status != healthpb.HealthCheckResponse_SERVING {
+		return errors.New(fmt.Sprintf("Health status is %s", response.Status))
+	}
+	return nil
+}
+
+// Checks that the destination's gRPC health service reports SERVING.
+func GRPC(dest *Destination) bool {
+	dest.Increment("connectivity.grpc", []string{})
+	t1 := time.Now()
+	if err := dest.GRPC.healthCheck(dest); err != nil {
+		dest.Increment("connectivity.grpc.error", []string{})
+		LogDestinationError(dest, "Failed gRPC health check", err)
+		return false
+	}
+	dest.Timer("connectivity.grpc", time.Since(t1), []string{})
+	dest.Increment("connectivity.grpc.success", []string{})
+	return true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// newGRPCServer serves the standard health service, with example.Up serving
+// and example.Down not, returning the server's port and tls options trusting
+// its certificate (if serving over TLS).
+func newGRPCServer(t *testing.T, useTLS bool) (int, TLSOptions) {
+	t.Helper()
+	l, serverConfig, options := listenTest(t, false)
+
+	var opts []grpc.ServerOption
+	if useTLS {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(serverConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("example.Up", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("example.Down", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+	return l.Addr().(*net.TCPAddr).Port, options
+}
+
+func TestParseGRPCCheck(t *testing.T) {
+	u, _ := url.Parse("grpcs://api.example.com/example.Up")
+	check, err := ParseGRPCCheck(u)
+	assertNoError(t, "ParseGRPCCheck", err)
+	if check.Service != "example.Up" {
+		t.Errorf("Service = %q; want example.Up", check.Service)
+	}
+
+	u, _ = url.Parse("grpc://api.example.com/example/Up")
+	_, err = ParseGRPCCheck(u)
+	assertErrorContains(t, err, "Invalid service name: example/Up")
+
+	dest, err := NewDestination(Url{Label: "grpcs", Url: "grpcs://api.example.com"})
+	assertNoError(t, "NewDestination", err)
+	if dest.Port != 443 || dest.GRPC == nil || dest.GRPC.Service != "" {
+		t.Errorf("grpcs:// port = %d, check = %+v; want 443 and the server's overall health", dest.Port, dest.GRPC)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	plain, _ := newGRPCServer(t, false)
+	secure, config := newGRPCServer(t, true)
+
+	cases := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "server", url: fmt.Sprintf("grpc://127.0.0.1:%d", plain)},
+		{name: "service", url: fmt.Sprintf("grpc://127.0.0.1:%d/example.Up", plain)},
+		{name: "not serving", url: fmt.Sprintf("grpc://127.0.0.1:%d/example.Down", plain), want: "Health status is NOT_SERVING"},
+		{name: "unknown service", url: fmt.Sprintf("grpc://127.0.0.1:%d/example.Unknown", plain), want: "code = NotFound"},
+		{name: "tls", url: fmt.Sprintf("grpcs://127.0.0.1:%d/example.Up", secure)},
+		{name: "tls to plaintext server", url: fmt.Sprintf("grpcs://127.0.0.1:%d", plain), want: "code = Unavailable"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			dest, err := NewDestination(Url{Label: "grpc", Url: tc.url, TLS: config})
+			assertNoError(t, "NewDestination", err)
+
+			err = dest.GRPC.healthCheck(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if GRPC(dest) {
+					t.Errorf("GRPC = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "healthCheck", err)
+			if !GRPC(dest) {
+				t.Errorf("GRPC = false; want true")
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// State is the confirmed condition of a destination, as opposed to the result
+// of any single check. It is exported as the connectivity.state gauge.
+type State int
+
+const (
+	StateUnknown State = iota
+	StateUp
+	StateDown
+	StateFlapping
+)
+
+func (s State) String() string {
+	switch s {
+	case StateUp:
+		return "up"
+	case StateDown:
+		return "down"
+	case StateFlapping:
+		return "flapping"
+	default:
+		return "unknown"
+	}
+}
+
+// Thresholds decide how many check results it takes to change a destination's
+// State. The zero value changes state on every result and never flaps.
+type Thresholds struct {
+	// FailureThreshold and SuccessThreshold are the number of consecutive
+	// failed or successful checks required to declare a destination down or
+	// up, respectively.
+	FailureThreshold int `yaml:"failure_threshold"`
+	SuccessThreshold int `yaml:"success_threshold"`
+
+	// FlapWindow is the number of most recent results considered for flap
+	// detection. A destination is flapping while at least FlapThreshold of
+	// those results differ from the one before (defaults to half the window).
+	FlapWindow    int `yaml:"flap_window"`
+	FlapThreshold int `yaml:"flap_threshold"`
+}
+
+func (t Thresholds) Validate() error {
+	if t.FailureThreshold < 0 || t.SuccessThreshold < 0 || t.FlapWindow < 0 || t.FlapThreshold < 0 {
+		return errors.New("thresholds must not be negative")
+	}
+	if t.FlapThreshold != 0 && t.FlapWindow == 0 {
+		return errors.New("flap_threshold requires flap_window")
+	}
+	if t.FlapWindow == 1 {
+		return errors.New("flap_window must be at least 2")
+	}
+	if t.FlapThreshold >= t.FlapWindow && t.FlapWindow != 0 {
+		return errors.New(fmt.Sprintf("flap_threshold must be less than flap_window (%d)", t.FlapWindow))
+	}
+	return nil
+}
+
+func (t Thresholds) failures() int {
+	if t.FailureThreshold == 0 {
+		return 1
+	}
+	return t.FailureThreshold
+}
+
+func (t Thresholds) successes() int {
+	if t.SuccessThreshold == 0 {
+		return 1
+	}
+	return t.SuccessThreshold
+}
+
+func (t Thresholds) flaps() int {
+	if t.FlapThreshold == 0 {
+		return t.FlapWindow / 2
+	}
+	return t.FlapThreshold
+}
+
+// Health accumulates check results for a single destination and derives its
+// State. It is not safe for concurrent use; each Monitor goroutine owns one.
+type Health struct {
+	Thresholds Thresholds
+	State      State
+
+	// The number of consecutive results equal to last
+	streak int
+	last   bool
+
+	// The most recent results, oldest first, up to Thresholds.FlapWindow
+	window []bool
+}
+
+// Record adds a check result and returns the State that preceded it, so the
+// caller can tell whether the State changed.
+func (h *Health) Record(ok bool) State {
+	previous := h.State
+
+	if ok == h.last && h.streak > 0 {
+		h.streak += 1
+	} else {
+		h.last = ok
+		h.streak = 1
+	}
+
+	if h.Thresholds.FlapWindow > 0 {
+		h.window = append(h.window, ok)
+		if len(h.window) > h.Thresholds.FlapWindow {
+			h.window = h.window[1:]
+		}
+	}
+
+	if h.Flaps() >= h.Thresholds.flaps() && h.Thresholds.FlapWindow > 0 {
+		h.State = StateFlapping
+	} else if ok && h.streak >= h.Thresholds.successes() {
+		h.State = StateUp
+	} else if !ok && h.streak >= h.Thresholds.failures() {
+		h.State = StateDown
+	}
+
+	return previous
+}
+
+// Flaps counts the state changes among the results in the flap window.
+func (h *Health) Flaps() int {
+	flaps := 0
+	for i := 1; i < len(h.window); i++ {
+		if h.window[i] != h.window[i-1] {
+			flaps += 1
+		}
+	}
+	return flaps
+}
+
+// Describe explains the current State for logging purposes.
+func (h *Health) Describe() string {
+	if h.State == StateFlapping {
+		return fmt.Sprintf("%s (%d changes in the last %d checks)", h.State, h.Flaps(), len(h.window))
+	}
+	result := "successful"
+	if !h.last {
+		result = "failed"
+	}
+	return fmt.Sprintf("%s (%d consecutive %s checks)", h.State, h.streak, result)
+}
@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+// recordAll feeds results into h and returns the State after each one.
+func recordAll(h *Health, results []bool) []State {
+	var states []State
+	for _, ok := range results {
+		h.Record(ok)
+		states = append(states, h.State)
+	}
+	return states
+}
+
+func assertStatesEqual(t *testing.T, got []State, want []State) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("len(states) = %d; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("states[%d] = %s; want %s (all: %v)", i, got[i], want[i], got)
+		}
+	}
+}
+
+func TestHealth_DefaultThresholdsFollowEveryResult(t *testing.T) {
+	h := &Health{}
+	got := recordAll(h, []bool{true, false, true})
+	assertStatesEqual(t, got, []State{StateUp, StateDown, StateUp})
+}
+
+func TestHealth_FailureThresholdIgnoresIsolatedFailures(t *testing.T) {
+	h := &Health{Thresholds: Thresholds{FailureThreshold: 3}}
+	got := recordAll(h, []bool{true, false, true, false, false, false, true})
+	assertStatesEqual(t, got, []State{StateUp, StateUp, StateUp, StateUp, StateUp, StateDown, StateUp})
+}
+
+func TestHealth_SuccessThresholdDelaysRecovery(t *testing.T) {
+	h := &Health{Thresholds: Thresholds{SuccessThreshold: 2}}
+	got := recordAll(h, []bool{true, false, true, true})
+	assertStatesEqual(t, got, []State{StateUnknown, StateDown, StateDown, StateUp})
+}
+
+func TestHealth_RecordReturnsPreviousState(t *testing.T) {
+	h := &Health{}
+	if previous := h.Record(true); previous != StateUnknown {
+		t.Errorf("first Record() = %s; want %s", previous, StateUnknown)
+	}
+	if previous := h.Record(false); previous != StateUp {
+		t.Errorf("second Record() = %s; want %s", previous, StateUp)
+	}
+}
+
+func TestHealth_FlappingWithinWindow(t *testing.T) {
+	h := &Health{Thresholds: Thresholds{FlapWindow: 4, FlapThreshold: 2}}
+	got := recordAll(h, []bool{true, false, true, true, true, true})
+	assertStatesEqual(t, got, []State{StateUp, StateDown, StateFlapping, StateFlapping, StateUp, StateUp})
+	if got := h.Flaps(); got != 0 {
+		t.Errorf("Flaps() = %d; want 0 once the window is stable", got)
+	}
+}
+
+func TestHealth_FlappingRequiresConfirmationToLeave(t *testing.T) {
+	h := &Health{Thresholds: Thresholds{SuccessThreshold: 3, FlapWindow: 4, FlapThreshold: 2}}
+	got := recordAll(h, []bool{true, false, true, true, true})
+	assertStatesEqual(t, got, []State{StateUnknown, StateDown, StateFlapping, StateFlapping, StateUp})
+}
+
+func TestHealth_Describe(t *testing.T) {
+	h := &Health{Thresholds: Thresholds{FailureThreshold: 2}}
+	recordAll(h, []bool{false, false})
+	if got, want := h.Describe(), "down (2 consecutive failed checks)"; got != want {
+		t.Errorf("Describe() = %q; want %q", got, want)
+	}
+
+	h = &Health{Thresholds: Thresholds{FlapWindow: 3}}
+	recordAll(h, []bool{true, false, true})
+	if got, want := h.Describe(), "flapping (2 changes in the last 3 checks)"; got != want {
+		t.Errorf("Describe() = %q; want %q", got, want)
+	}
+}
+
+func TestThresholds_Validate(t *testing.T) {
+	cases := []struct {
+		name       string
+		thresholds Thresholds
+		substr     string
+	}{
+		{name: "negative", thresholds: Thresholds{FailureThreshold: -1}, substr: "negative"},
+		{name: "flap_threshold_without_window", thresholds: Thresholds{FlapThreshold: 2}, substr: "requires flap_window"},
+		{name: "window_of_one", thresholds: Thresholds{FlapWindow: 1}, substr: "at least 2"},
+		{name: "threshold_not_below_window", thresholds: Thresholds{FlapWindow: 4, FlapThreshold: 4}, substr: "less than flap_window"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertErrorContains(t, tc.thresholds.Validate(), tc.substr)
+		})
+	}
+
+	assertNoError(t, "Thresholds{FlapWindow: 10}.Validate()", Thresholds{FlapWindow: 10}.Validate())
+}
@@ -35,6 +35,7 @@ func PrintUsage() {
 	fmt.Println("  check            Check all connectivity once and exit")
 	fmt.Println("  wait             Wait for all connectivity to be validated successfully")
 	fmt.Println("  monitor          Continuously monitor all connectivity forever")
+	fmt.Println("  report           Summarize uptime and check times recorded by monitor")
 	fmt.Println("  validate-config  Load config without making any network requests")
 	fmt.Println("  version          Show version information")
 	fmt.Println("  help             Show this help text")
@@ -65,6 +66,21 @@ func PrintCommandUsage(command string) bool {
 		fmt.Println("")
 		fmt.Println("This is useful to run as a daemon for continuously monitoring network")
 		fmt.Println("dependencies. The results of each check are emitted via statsd.")
+	} else if command == "report" {
+		fmt.Println("Summarize uptime and check times recorded by monitor.")
+		fmt.Println("")
+		fmt.Println("Usage: connectivity report [--since <period>]")
+		fmt.Println("")
+		fmt.Println("For each destination, reports uptime, error budget burn, check time")
+		fmt.Println("percentiles (p50/p95/p99, of how long each whole check took, including")
+		fmt.Println("lookups and pings) and outage windows since the given period ago (such as")
+		fmt.Println("12h or 7d; the default is 7d). Results are only recorded while monitoring")
+		fmt.Println("if a history path is configured:")
+		fmt.Println("")
+		fmt.Println("history:")
+		fmt.Println("  path: /var/lib/connectivity/history.jsonl")
+		fmt.Println("  retention: 720h")
+		fmt.Println("  slo: 99.9")
 	} else if command == "version" {
 		fmt.Println("Show version information about this build")
 		fmt.Println("")
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+/*
+
+This module persists the result of every monitor check to an append-only
+JSON lines file, so that `connectivity report` can compute uptime and check
+durations after the fact. Old results are pruned according to the configured retention.
+
+*/
+
+const (
+	DefaultHistoryRetention = 30 * 24 * time.Hour
+	DefaultSLO              = 99.9
+)
+
+type HistoryConfig struct {
+	// Path to the JSON lines file. History is disabled if this is empty.
+	Path string `yaml:"path"`
+
+	// Results older than this are pruned from the file.
+	Retention time.Duration `yaml:"retention"`
+
+	// The target uptime percentage that `connectivity report` measures the
+	// error budget against.
+	SLO float64 `yaml:"slo"`
+}
+
+func (c HistoryConfig) retention() time.Duration {
+	if c.Retention <= 0 {
+		return DefaultHistoryRetention
+	}
+	return c.Retention
+}
+
+func (c HistoryConfig) Validate() error {
+	if c.Retention < 0 {
+		return errors.New("retention must not be negative")
+	}
+	if c.SLO < 0 || c.SLO >= 100 {
+		// 100% leaves no error budget to measure against
+		return errors.New(fmt.Sprintf("slo must be greater than 0 and less than 100: %g", c.SLO))
+	}
+	return nil
+}
+
+func (c HistoryConfig) slo() float64 {
+	if c.SLO == 0 {
+		return DefaultSLO
+	}
+	return c.SLO
+}
+
+// Result is a single line of the history file.
+type Result struct {
+	Time        time.Time `json:"time"`
+	Destination string    `json:"destination"`
+	OK          bool      `json:"ok"`
+	State       string    `json:"state,omitempty"`
+
+	// How long the whole check took, including name resolution, pings and
+	// every address checked, rather than the latency of any one connection
+	DurationMs float64 `json:"duration_ms"`
+
+	// How long the monitor waited before checking the destination again
+	IntervalMs float64 `json:"interval_ms,omitempty"`
+
+	// The class of lookup failure, if the host failed to resolve
+	LookupError string `json:"lookup_error,omitempty"`
+}
+
+func (r Result) Duration() time.Duration {
+	return time.Duration(r.DurationMs * float64(time.Millisecond))
+}
+
+// Down reports whether the destination was down (or flapping) as of this
+// result, according to its thresholds. Results that predate state fall back
+// to whether the check itself failed.
+func (r Result) Down() bool {
+	if r.State == "" {
+		return !r.OK
+	}
+	return r.State == StateDown.String() || r.State == StateFlapping.String()
+}
+
+// Interval is how long after this result the next one was due. Results that
+// predate interval_ms assume the default minimum interval.
+func (r Result) Interval() time.Duration {
+	if r.IntervalMs <= 0 {
+		return DefaultMinInterval
+	}
+	return time.Duration(r.IntervalMs * float64(time.Millisecond))
+}
+
+type History struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	lastPrune time.Time
+}
+
+// history is the store Monitor records results to, if one is configured.
+var history *History
+
+func OpenHistory(config HistoryConfig) (*History, error) {
+	if config.Path == "" {
+		return nil, errors.New("No history path configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, err
+	}
+
+	h := &History{path: config.Path, retention: config.retention()}
+	if err := h.Prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Append writes a result to the end of the history file, pruning expired
+// results at most once an hour.
+func (h *History) Append(r Result) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r.Time.Sub(h.lastPrune) > time.Hour {
+		if err := h.prune(r.Time); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Prune rewrites the history file without any results that are older than
+// the retention period.
+func (h *History) Prune(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.prune(now)
+}
+
+func (h *History) prune(now time.Time) error {
+	h.lastPrune = now
+
+	results, err := ReadHistory(h.path, now.Add(-h.retention))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	tmp := h.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// ReadHistory returns every result in the history file recorded at or after
+// since, in the order they were written. Lines that fail to parse (such as a
+// line truncated by a crash) are skipped.
+func ReadHistory(path string, since time.Time) ([]Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []Result
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Result
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if !r.Time.Before(since) {
+			results = append(results, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to read history (%s): %v", path, err))
+	}
+	return results, nil
+}
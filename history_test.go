@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T, retention time.Duration) (*History, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history", "results.jsonl")
+	h, err := OpenHistory(HistoryConfig{Path: path, Retention: retention})
+	if err != nil {
+		t.Fatalf("OpenHistory(%q): %v", path, err)
+	}
+	return h, path
+}
+
+func TestHistory_AppendAndRead(t *testing.T) {
+	h, path := openTestHistory(t, 0)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	want := []Result{
+		{Time: now, Destination: "a", OK: true, DurationMs: 1.5, State: "up"},
+		{Time: now.Add(time.Minute), Destination: "b", OK: false, DurationMs: 3000},
+	}
+	for _, r := range want {
+		if err := h.Append(r); err != nil {
+			t.Fatalf("Append(%+v): %v", r, err)
+		}
+	}
+
+	got, err := ReadHistory(path, now)
+	if err != nil {
+		t.Fatalf("ReadHistory: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("len(ReadHistory()) = %d; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Destination != want[i].Destination || got[i].OK != want[i].OK || got[i].DurationMs != want[i].DurationMs || got[i].State != want[i].State {
+			t.Errorf("ReadHistory()[%d] = %+v; want %+v", i, got[i], want[i])
+		}
+	}
+
+	got, err = ReadHistory(path, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("ReadHistory: %v", err)
+	}
+	if len(got) != 1 || got[0].Destination != "b" {
+		t.Errorf("ReadHistory(since) = %+v; want only the later result", got)
+	}
+}
+
+func TestHistory_PruneDropsExpiredResults(t *testing.T) {
+	h, path := openTestHistory(t, time.Hour)
+	now := time.Now().UTC()
+
+	for _, r := range []Result{
+		{Time: now.Add(-2 * time.Hour), Destination: "old", OK: true},
+		{Time: now.Add(-time.Minute), Destination: "new", OK: true},
+	} {
+		if err := h.Append(r); err != nil {
+			t.Fatalf("Append(%+v): %v", r, err)
+		}
+	}
+
+	if err := h.Prune(now); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	got, err := ReadHistory(path, time.Time{})
+	if err != nil {
+		t.Fatalf("ReadHistory: %v", err)
+	}
+	if len(got) != 1 || got[0].Destination != "new" {
+		t.Errorf("ReadHistory() after Prune = %+v; want only %q", got, "new")
+	}
+}
+
+func TestReadHistory_SkipsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	content := "" +
+		`{"time":"2026-01-01T00:00:00Z","destination":"a","ok":true,"duration_ms":1}` + "\n" +
+		`{"time":"2026-01-01T00:01:00Z","destin` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("os.WriteFile(%q): %v", path, err)
+	}
+
+	got, err := ReadHistory(path, time.Time{})
+	if err != nil {
+		t.Fatalf("ReadHistory: %v", err)
+	}
+	if len(got) != 1 {
+		t.Errorf("len(ReadHistory()) = %d; want 1", len(got))
+	}
+}
+
+func TestOpenHistory_RequiresPath(t *testing.T) {
+	_, err := OpenHistory(HistoryConfig{})
+	assertErrorContains(t, err, "No history path")
+}
+
+// TestMonitorWithCheckRecordsHistory verifies that each monitor iteration
+// appends its result, including the destination's State, to the history.
+func TestMonitorWithCheckRecordsHistory(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	h, path := openTestHistory(t, 0)
+	history = h
+	t.Cleanup(func() { history = nil })
+
+	dest := &Destination{Label: "stub", Host: "host", Port: 1}
+	sleep := func(time.Duration) {}
+	confidence := dest.monitorWithCheck(1, func() bool { return true }, sleep)
+	dest.monitorWithCheck(confidence, func() bool { return false }, sleep)
+
+	got, err := ReadHistory(path, time.Time{})
+	if err != nil {
+		t.Fatalf("ReadHistory: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("len(ReadHistory()) = %d; want 2", len(got))
+	}
+	if got[0].Destination != "stub" || !got[0].OK || got[0].State != "up" || got[0].Interval() != 2*time.Minute {
+		t.Errorf("ReadHistory()[0] = %+v; want a successful check of stub while up, 2m before the next", got[0])
+	}
+	if got[1].OK || got[1].State != "down" || got[1].Interval() != time.Minute {
+		t.Errorf("ReadHistory()[1] = %+v; want a failed check while down, 1m before the next", got[1])
+	}
+}
+
+func TestHistoryConfig_Validate(t *testing.T) {
+	for _, slo := range []float64{0, 50, 99.99} {
+		if err := (HistoryConfig{SLO: slo}).Validate(); err != nil {
+			t.Errorf("Validate(slo: %g) = %v; want nil", slo, err)
+		}
+	}
+	for _, slo := range []float64{-1, 100, 101} {
+		err := HistoryConfig{SLO: slo}.Validate()
+		assertErrorContains(t, err, "slo must be greater than 0 and less than 100")
+	}
+	assertErrorContains(t, HistoryConfig{Retention: -time.Hour}.Validate(), "retention must not be negative")
+}
@@ -7,12 +7,34 @@ import (
 // Performs a complete HTTP(S) request to the destination.
 func HTTPS(dest *Destination) bool {
 	dest.Increment("connectivity.http", []string{})
-	_, err := http.Get(dest.URL)
+	resp, err := dest.httpClient().Get(dest.URL)
 	if err != nil {
 		dest.Increment("connectivity.http.error", []string{})
 		LogDestinationError(dest, "Failed HTTP GET", err)
 		return false
 	}
+	resp.Body.Close()
 	dest.Increment("connectivity.http.success", []string{})
 	return true
 }
+
+// httpClient returns a client that resolves hosts the same way as the rest of
+// the destination's checks, building it on first use.
+func (dest *Destination) httpClient() *http.Client {
+	if dest.client != nil {
+		return dest.client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dest.DialContext
+	if dest.TLSConfig != nil {
+		transport.TLSClientConfig = dest.TLSConfig.Clone()
+	}
+
+	// Connections go through the destination's proxy, if any, like every
+	// other stage, rather than one from the environment
+	transport.Proxy = nil
+	transport.DisableKeepAlives = true
+	dest.client = &http.Client{Transport: transport}
+	return dest.client
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // newTestDestination returns a *Destination wired to the given URL with a
@@ -37,6 +39,46 @@ func TestHTTPS_Returns200(t *testing.T) {
 	}
 }
 
+// TestHTTPS_ClosesResponses checks that each response is closed, even one that
+// isn't read to the end, and that the destination's client is reused.
+func TestHTTPS_ClosesResponses(t *testing.T) {
+	var open int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// More than fits in the connection's buffers, so the handler only
+		// returns once the client reads or closes the body
+		w.Write(make([]byte, 8<<20))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&open, 1)
+		} else if state == http.StateClosed || state == http.StateHijacked {
+			atomic.AddInt32(&open, -1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	t.Cleanup(srv.CloseClientConnections)
+
+	dest := newTestDestination(t, srv.URL)
+	client := dest.httpClient()
+	for i := 0; i < 3; i++ {
+		if !HTTPS(dest) {
+			t.Fatalf("HTTPS = false; want true")
+		}
+	}
+	if dest.httpClient() != client {
+		t.Errorf("httpClient() built a new client; want the destination's client reused")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&open) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&open); got != 0 {
+		t.Errorf("%d connections still open; want every response closed", got)
+	}
+}
+
 // TestHTTPS_Returns500ButReportsSuccess documents that HTTPS does not check
 // the response status code, so a 5xx response still returns true. The Go
 // stdlib http.Get only returns an error for transport-level failures (DNS,
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+This module checks Kafka clusters. The bootstrap broker is asked which API
+versions it supports (ApiVersions), and for the cluster's brokers (Metadata),
+each of which must be reachable at the address it advertises. Brokers that
+advertise a listener clients can't reach (such as localhost, or an internal
+hostname) are a common misconfiguration that dialing the bootstrap broker
+alone doesn't catch.
+
+*/
+
+const DefaultKafkaTimeout = 10 * time.Second
+
+const (
+	kafkaMetadata    = 3
+	kafkaAPIVersions = 18
+)
+
+// KafkaBroker is a broker, as listed in a Metadata response.
+type KafkaBroker struct {
+	NodeID int32
+	Host   string
+	Port   int32
+}
+
+func (b KafkaBroker) String() string {
+	return fmt.Sprintf("%d (%s)", b.NodeID, b.Address())
+}
+
+// Address returns the broker's advertised address.
+func (b KafkaBroker) Address() string {
+	return net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port)))
+}
+
+// kafkaDecoder reads Kafka's data types, remembering the first error.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errors.New("Truncated response")
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+// string reads a nullable string, where null is read as "".
+func (d *kafkaDecoder) string() string {
+	length := d.int16()
+	if length < 0 {
+		return ""
+	}
+	return string(d.take(int(length)))
+}
+
+// kafkaConn sends requests and reads their responses.
+type kafkaConn struct {
+	conn          net.Conn
+	correlationID int32
+}
+
+func (c *kafkaConn) request(apiKey int16, apiVersion int16, body []byte) (*kafkaDecoder, error) {
+	c.correlationID++
+	msg := binary.BigEndian.AppendUint16(nil, uint16(apiKey))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(apiVersion))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(c.correlationID))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len("connectivity")))
+	msg = append(msg, "connectivity"...)
+	msg = append(msg, body...)
+	if _, err := c.conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(msg))), msg...)); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size < 4 || size > 1<<20 {
+		return nil, errors.New(fmt.Sprintf("Invalid response size: %d", size))
+	}
+	response := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, response); err != nil {
+		return nil, err
+	}
+	d := &kafkaDecoder{b: response}
+	if id := d.int32(); id != c.correlationID {
+		return nil, errors.New(fmt.Sprintf("Response has correlation ID %d; expected %d", id, c.correlationID))
+	}
+	return d, nil
+}
+
+// apiVersions checks that the broker supports version 1 of Metadata.
+func (c *kafkaConn) apiVersions() error {
+	d, err := c.request(kafkaAPIVersions, 0, nil)
+	if err != nil {
+		return errors.New(fmt.Sprintf("ApiVersions failed: %v", err))
+	}
+	if code := d.int16(); code != 0 {
+		return errors.New(fmt.Sprintf("ApiVersions failed with error code %d", code))
+	}
+	count := d.int32()
+	for i := int32(0); i < count && d.err == nil; i++ {
+		key, min, max := d.int16(), d.int16(), d.int16()
+		if key == kafkaMetadata && min <= 1 && max >= 1 {
+			return nil
+		}
+	}
+	if d.err != nil {
+		return errors.New(fmt.Sprintf("Invalid ApiVersions response: %v", d.err))
+	}
+	return errors.New("Broker does not support version 1 of Metadata requests")
+}
+
+// metadata lists the cluster's brokers, and its controller.
+func (c *kafkaConn) metadata() ([]KafkaBroker, int32, error) {
+	// An empty list of topics, rather than null (all topics)
+	d, err := c.request(kafkaMetadata, 1, []byte{0, 0, 0, 0})
+	if err != nil {
+		return nil, 0, errors.New(fmt.Sprintf("Metadata failed: %v", err))
+	}
+	var brokers []KafkaBroker
+	count := d.int32()
+	for i := int32(0); i < count && d.err == nil; i++ {
+		broker := KafkaBroker{NodeID: d.int32(), Host: d.string(), Port: d.int32()}
+		d.string() // rack
+		brokers = append(brokers, broker)
+	}
+	controller := d.int32()
+	if d.err != nil {
+		return nil, 0, errors.New(fmt.Sprintf("Invalid Metadata response: %v", d.err))
+	}
+	if len(brokers) == 0 {
+		return nil, 0, errors.New("Metadata lists no brokers")
+	}
+	return brokers, controller, nil
+}
+
+// kafkaCluster queries the bootstrap broker, and dials each broker listed,
+// returning them and the cluster's controller.
+func kafkaCluster(dest *Destination) ([]KafkaBroker, int32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultKafkaTimeout)
+	defer cancel()
+
+	conn, err := dest.DialContext(ctx, "tcp", dest.HostPort())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	c := &kafkaConn{conn: conn}
+	if err := c.apiVersions(); err != nil {
+		return nil, 0, err
+	}
+	brokers, controller, err := c.metadata()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var unreachable []string
+	for _, broker := range brokers {
+		brokerConn, err := dest.DialContext(ctx, "tcp", broker.Address())
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("broker %s: %v", broker, err))
+			continue
+		}
+		brokerConn.Close()
+	}
+	if len(unreachable) > 0 {
+		return brokers, controller, errors.New(fmt.Sprintf("Advertised listeners are unreachable: %s", strings.Join(unreachable, "; ")))
+	}
+	return brokers, controller, nil
+}
+
+// Checks that the destination is a Kafka broker, and that the brokers it
+// advertises are reachable.
+func Kafka(dest *Destination) bool {
+	dest.Increment("connectivity.kafka", []string{})
+	t1 := time.Now()
+	brokers, controller, err := kafkaCluster(dest)
+	if err != nil {
+		dest.Increment("connectivity.kafka.error", []string{})
+		LogDestinationError(dest, "Failed Kafka check", err)
+		return false
+	}
+	dest.Timer("connectivity.kafka", time.Since(t1), []string{})
+	dest.Increment("connectivity.kafka.success", []string{})
+
+	var listed []string
+	for _, broker := range brokers {
+		listed = append(listed, broker.String())
+	}
+	LogDestination(dest, fmt.Sprintf("Kafka brokers: %s; controller %d", strings.Join(listed, ", "), controller))
+	return true
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+// newKafkaServer answers ApiVersions and Metadata requests, advertising
+// itself as broker 1 and, if extraPort is set, broker 2 on that port. The
+// highest version of Metadata supported is metadataVersion.
+func newKafkaServer(t *testing.T, extraPort int, metadataVersion int16) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, "Listen", err)
+	t.Cleanup(func() { l.Close() })
+	port := l.Addr().(*net.TCPAddr).Port
+
+	broker := func(b []byte, nodeID int32, port int) []byte {
+		b = binary.BigEndian.AppendUint32(b, uint32(nodeID))
+		b = append(binary.BigEndian.AppendUint16(b, 9), "127.0.0.1"...)
+		b = binary.BigEndian.AppendUint32(b, uint32(port))
+		return binary.BigEndian.AppendUint16(b, 0xffff) // no rack
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer func() { conn.Close() }()
+				for {
+					header := make([]byte, 4)
+					if _, err := io.ReadFull(conn, header); err != nil {
+						return
+					}
+					request := make([]byte, binary.BigEndian.Uint32(header))
+					if _, err := io.ReadFull(conn, request); err != nil {
+						return
+					}
+					apiKey := binary.BigEndian.Uint16(request)
+					response := request[4:8] // correlation ID
+
+					switch apiKey {
+					case kafkaAPIVersions:
+						response = append(response, 0, 0, 0, 0, 0, 2)
+						response = append(response, 0, kafkaMetadata, 0, 0, 0, byte(metadataVersion))
+						response = append(response, 0, kafkaAPIVersions, 0, 0, 0, 3)
+					case kafkaMetadata:
+						brokers := 1
+						if extraPort != 0 {
+							brokers = 2
+						}
+						response = binary.BigEndian.AppendUint32(response, uint32(brokers))
+						response = broker(response, 1, port)
+						if extraPort != 0 {
+							response = broker(response, 2, extraPort)
+						}
+						response = binary.BigEndian.AppendUint32(response, 1) // controller
+						response = binary.BigEndian.AppendUint32(response, 0) // topics
+					}
+					conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(response))), response...))
+				}
+			}(conn)
+		}
+	}()
+	return port
+}
+
+func closedTCPPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, "Listen", err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestKafka(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	second := newKafkaServer(t, 0, 9)
+	port := newKafkaServer(t, second, 9)
+	dest, err := NewDestination(Url{Label: "kafka", Url: fmt.Sprintf("kafka://127.0.0.1:%d", port)})
+	assertNoError(t, "NewDestination", err)
+	brokers, controller, err := kafkaCluster(dest)
+	assertNoError(t, "kafkaCluster", err)
+	if len(brokers) != 2 || brokers[1].String() != fmt.Sprintf("2 (127.0.0.1:%d)", second) || controller != 1 {
+		t.Errorf("kafkaCluster = %v, %d; want brokers 1 and 2, and controller 1", brokers, controller)
+	}
+	if !Kafka(dest) {
+		t.Errorf("Kafka = false; want true")
+	}
+}
+
+func TestKafkaUnreachableListener(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	closed := closedTCPPort(t)
+	port := newKafkaServer(t, closed, 9)
+	dest, err := NewDestination(Url{Label: "kafka", Url: fmt.Sprintf("kafka://127.0.0.1:%d", port)})
+	assertNoError(t, "NewDestination", err)
+	_, _, err = kafkaCluster(dest)
+	assertErrorContains(t, err, fmt.Sprintf("Advertised listeners are unreachable: broker 2 (127.0.0.1:%d)", closed))
+	if Kafka(dest) {
+		t.Errorf("Kafka = true; want false")
+	}
+}
+
+func TestKafkaUnsupportedMetadata(t *testing.T) {
+	port := newKafkaServer(t, 0, 0)
+	dest, err := NewDestination(Url{Label: "kafka", Url: fmt.Sprintf("kafka://127.0.0.1:%d", port)})
+	assertNoError(t, "NewDestination", err)
+	_, _, err = kafkaCluster(dest)
+	assertErrorContains(t, err, "does not support version 1 of Metadata")
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+)
+
+type ldapServerOptions struct {
+	tls      bool
+	startTLS bool
+	dn       string
+	password string
+	entry    string
+}
+
+// berRead reads exactly one BER element from r, unbuffered, so that nothing
+// after it (such as a StartTLS handshake) is consumed.
+func berRead(r io.Reader) (asn1.RawValue, error) {
+	var element asn1.RawValue
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return element, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		size := make([]byte, length&0x7f)
+		if _, err := io.ReadFull(r, size); err != nil {
+			return element, err
+		}
+		header = append(header, size...)
+		length = 0
+		for _, b := range size {
+			length = length<<8 | int(b)
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return element, err
+	}
+	_, err := asn1.Unmarshal(append(header, body...), &element)
+	return element, err
+}
+
+// berChildren splits a constructed element into the elements it contains.
+func berChildren(element asn1.RawValue) []asn1.RawValue {
+	var children []asn1.RawValue
+	for rest := element.Bytes; len(rest) > 0; {
+		var child asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &child); err != nil {
+			break
+		}
+		children = append(children, child)
+	}
+	return children
+}
+
+// berMarshal encodes v, which must be encodable.
+func berMarshal(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// ldapMessage wraps a protocol operation (with the given application tag) in
+// an LDAPMessage.
+func ldapMessage(messageID int64, tag int, op ...[]byte) []byte {
+	return berMarshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: bytes.Join([][]byte{
+		berMarshal(messageID),
+		berMarshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: tag, IsCompound: true, Bytes: bytes.Join(op, nil)}),
+	}, nil)})
+}
+
+// ldapResult builds a response to messageID of the given type, such as a
+// BindResponse.
+func ldapResult(messageID int64, tag int, code int) []byte {
+	return ldapMessage(messageID, tag, berMarshal(asn1.Enumerated(code)), berMarshal([]byte{}), berMarshal([]byte{}))
+}
+
+// ldapEntry builds a SearchResultEntry, without attributes.
+func ldapEntry(messageID int64, dn string) []byte {
+	return ldapMessage(messageID, 4, berMarshal([]byte(dn)), berMarshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true}))
+}
+
+// newLDAPServer answers bind, StartTLS and search requests, accepting only
+// the configured credentials (or anonymous binds, if there are none), and
+// returns the server's port and tls options trusting its certificate.
+func newLDAPServer(t *testing.T, opts ldapServerOptions) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, opts.tls, func(conn net.Conn, serverConfig *tls.Config) {
+		for {
+			// Read unbuffered, so that a StartTLS handshake isn't consumed
+			packet, err := berRead(conn)
+			if err != nil {
+				return
+			}
+			message := berChildren(packet)
+			if len(message) < 2 {
+				return
+			}
+			var messageID int64
+			asn1.Unmarshal(message[0].FullBytes, &messageID)
+			request := berChildren(message[1])
+
+			switch message[1].Tag {
+			case 0: // BindRequest
+				name := string(request[1].Bytes)
+				password := string(request[2].Bytes)
+				code := 0
+				if name != opts.dn || password != opts.password {
+					code = 49 // invalidCredentials
+				}
+				conn.Write(ldapResult(messageID, 1, code))
+			case 2: // UnbindRequest
+				return
+			case 3: // SearchRequest
+				if dn := string(request[0].Bytes); dn == opts.entry {
+					conn.Write(ldapEntry(messageID, dn))
+					conn.Write(ldapResult(messageID, 5, 0))
+				} else {
+					conn.Write(ldapResult(messageID, 5, 32)) // noSuchObject
+				}
+			case 23: // ExtendedRequest
+				if !opts.startTLS || string(request[0].Bytes) != "1.3.6.1.4.1.1466.20037" {
+					conn.Write(ldapResult(messageID, 24, 2)) // protocolError
+					continue
+				}
+				conn.Write(ldapResult(messageID, 24, 0))
+				conn = tls.Server(conn, serverConfig)
+			}
+		}
+	})
+}
+
+func TestParseLDAPCheck(t *testing.T) {
+	u, _ := url.Parse("ldap://ldap.example.com/dc=example,dc=com?starttls=true")
+	check, err := ParseLDAPCheck(u)
+	assertNoError(t, "ParseLDAPCheck", err)
+	if !check.StartTLS || check.BaseDN != "dc=example,dc=com" {
+		t.Errorf("check = %+v; want StartTLS and a base DN of dc=example,dc=com", check)
+	}
+
+	u, _ = url.Parse("ldaps://ldap.example.com?starttls=true")
+	_, err = ParseLDAPCheck(u)
+	assertErrorContains(t, err, "starttls is only supported by ldap:// destinations")
+
+	u, _ = url.Parse("ldap://ldap.example.com?starttls=maybe")
+	_, err = ParseLDAPCheck(u)
+	assertErrorContains(t, err, "Invalid starttls: maybe")
+
+	for scheme, port := range map[string]int{"ldap": 389, "ldaps": 636} {
+		dest, err := NewDestination(Url{Label: scheme, Url: scheme + "://ldap.example.com"})
+		assertNoError(t, "NewDestination", err)
+		if dest.Port != port || dest.LDAP == nil {
+			t.Errorf("%s:// port = %d, check = %v; want %d and an LDAP check", scheme, dest.Port, dest.LDAP, port)
+		}
+	}
+}
+
+func TestLDAP(t *testing.T) {
+	admin := ldapServerOptions{dn: "cn=admin,dc=example,dc=com", password: "secret", entry: "dc=example,dc=com"}
+	startTLS := admin
+	startTLS.startTLS = true
+	implicitTLS := admin
+	implicitTLS.tls = true
+
+	cases := []struct {
+		name   string
+		scheme string
+		url    string
+		opts   ldapServerOptions
+		want   string
+	}{
+		{name: "anonymous", scheme: "ldap", url: "%s"},
+		{name: "simple bind", scheme: "ldap", url: "cn=admin,dc=example,dc=com:secret@%s", opts: admin},
+		{name: "wrong password", scheme: "ldap", url: "cn=admin,dc=example,dc=com:wrong@%s", opts: admin, want: "Bind as cn=admin,dc=example,dc=com failed"},
+		{name: "anonymous refused", scheme: "ldap", url: "%s", opts: admin, want: "Anonymous bind failed"},
+		{name: "search", scheme: "ldap", url: "cn=admin,dc=example,dc=com:secret@%s/dc=example,dc=com", opts: admin},
+		{name: "missing entry", scheme: "ldap", url: "cn=admin,dc=example,dc=com:secret@%s/dc=missing,dc=com", opts: admin, want: "Search for dc=missing,dc=com failed"},
+		{name: "starttls", scheme: "ldap", url: "cn=admin,dc=example,dc=com:secret@%s/dc=example,dc=com?starttls=true", opts: startTLS},
+		{name: "starttls unsupported", scheme: "ldap", url: "%s?starttls=true", want: "StartTLS failed"},
+		{name: "tls", scheme: "ldaps", url: "cn=admin,dc=example,dc=com:secret@%s/dc=example,dc=com", opts: implicitTLS},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port, config := newLDAPServer(t, tc.opts)
+			dest, err := NewDestination(Url{Label: "ldap", Url: fmt.Sprintf("%s://%s", tc.scheme, fmt.Sprintf(tc.url, fmt.Sprintf("127.0.0.1:%d", port))), TLS: config})
+			assertNoError(t, "NewDestination", err)
+
+			err = ldapConversation(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if LDAP(dest) {
+					t.Errorf("LDAP = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "ldapConversation", err)
+			if !LDAP(dest) {
+				t.Errorf("LDAP = false; want true")
+			}
+		})
+	}
+}
@@ -1,13 +1,27 @@
 package main
 
-import "log"
+import (
+	"fmt"
+	"log"
+)
+
+// logf logs a line about the destination, unless Monitor is holding its lines
+// back until it knows the check's effect on the destination's State (see
+// recordHealth).
+func (dest *Destination) logf(format string, v ...interface{}) {
+	if dest.logs != nil {
+		dest.logs = append(dest.logs, fmt.Sprintf(format, v...))
+		return
+	}
+	log.Printf(format, v...)
+}
 
 func LogDestination(dest *Destination, msg string) {
-	log.Printf("%s %s %s", GetLocalIPs(), dest, msg)
+	dest.logf("%s %s %s", GetLocalIPs(), dest, msg)
 }
 
 func LogDestinationError(dest *Destination, msg string, err error) {
-	log.Printf("%s %s %s: %s", GetLocalIPs(), dest, msg, err)
+	dest.logf("%s %s %s: %s", GetLocalIPs(), dest, msg, err)
 }
 
 func LogRoute(route *Route, msg string) {
@@ -19,5 +33,5 @@ func LogRouteError(route *Route, msg string, err error) {
 }
 
 func LogRouteDestinationError(route *Route, dest *Destination, msg string, err error) {
-	log.Printf("%s %s %s: %s", route, dest, msg, err)
+	dest.logf("%s %s %s: %s", route, dest, msg, err)
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const DefaultMemcachedTimeout = 5 * time.Second
+
+// memcachedVersion asks the server for its version, using the text protocol.
+func memcachedVersion(dest *Destination) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultMemcachedTimeout)
+	defer cancel()
+
+	conn, err := dest.DialContext(ctx, "tcp", dest.HostPort())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if _, err := io.WriteString(conn, "version\r\n"); err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("No response to version: %v", err))
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	version, found := strings.CutPrefix(line, "VERSION ")
+	if !found {
+		return "", errors.New(fmt.Sprintf("Unexpected response to version: %q", truncateBytes([]byte(line), 64)))
+	}
+	return version, nil
+}
+
+// Checks that the destination is a responsive Memcached server.
+func Memcached(dest *Destination) bool {
+	dest.Increment("connectivity.memcached", []string{})
+	t1 := time.Now()
+	version, err := memcachedVersion(dest)
+	if err != nil {
+		dest.Increment("connectivity.memcached.error", []string{})
+		LogDestinationError(dest, "Failed Memcached check", err)
+		return false
+	}
+	dest.Timer("connectivity.memcached", time.Since(t1), []string{})
+	dest.Increment("connectivity.memcached.success", []string{})
+	LogDestination(dest, fmt.Sprintf("Memcached version: %s", version))
+	return true
+}
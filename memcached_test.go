@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// newMemcachedServer answers each line it receives with respond.
+func newMemcachedServer(t *testing.T, respond string) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, "Listen", err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer func() { conn.Close() }()
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+					fmt.Fprint(conn, respond)
+				}
+			}(conn)
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestMemcached(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	dest, err := NewDestination(Url{Label: "memcached", Url: "memcached://cache.example.com"})
+	assertNoError(t, "NewDestination", err)
+	if dest.Port != 11211 {
+		t.Errorf("Port = %d; want 11211", dest.Port)
+	}
+
+	port := newMemcachedServer(t, "VERSION 1.6.21\r\n")
+	dest, err = NewDestination(Url{Label: "memcached", Url: fmt.Sprintf("memcached://127.0.0.1:%d", port)})
+	assertNoError(t, "NewDestination", err)
+	version, err := memcachedVersion(dest)
+	assertNoError(t, "memcachedVersion", err)
+	if version != "1.6.21" {
+		t.Errorf("version = %q; want 1.6.21", version)
+	}
+	if !Memcached(dest) {
+		t.Errorf("Memcached = false; want true")
+	}
+
+	port = newMemcachedServer(t, "ERROR\r\n")
+	dest, err = NewDestination(Url{Label: "memcached", Url: fmt.Sprintf("memcached://127.0.0.1:%d", port)})
+	assertNoError(t, "NewDestination", err)
+	_, err = memcachedVersion(dest)
+	assertErrorContains(t, err, `Unexpected response to version: "ERROR"`)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const DefaultMQTTTimeout = 10 * time.Second
+
+// Return codes of CONNACK, per MQTT 3.1.1
+var mqttReturnCodes = map[byte]string{
+	0: "Connection accepted",
+	1: "Unacceptable protocol version",
+	2: "Identifier rejected",
+	3: "Server unavailable",
+	4: "Bad user name or password",
+	5: "Not authorized",
+}
+
+// mqttString encodes a UTF-8 string, prefixed with its length.
+func mqttString(b []byte, s string) []byte {
+	return append(binary.BigEndian.AppendUint16(b, uint16(len(s))), s...)
+}
+
+// mqttConnectPacket builds a CONNECT packet for a clean session, with the
+// given credentials, if any. A password can only be sent with a username.
+func mqttConnectPacket(clientID string, username string, password string, passwordSet bool) []byte {
+	passwordSet = passwordSet && username != ""
+	var flags byte = 0x02
+	if username != "" {
+		flags |= 0x80
+	}
+	if passwordSet {
+		flags |= 0x40
+	}
+
+	body := mqttString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, 30)
+	body = mqttString(body, clientID)
+	if username != "" {
+		body = mqttString(body, username)
+	}
+	if passwordSet {
+		body = mqttString(body, password)
+	}
+
+	// The remaining length is encoded 7 bits at a time
+	packet := []byte{0x10}
+	for length := len(body); ; {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// mqttConnect connects to the broker, and disconnects once accepted.
+func mqttConnect(dest *Destination) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultMQTTTimeout)
+	defer cancel()
+
+	conn, err := dest.DialContext(ctx, "tcp", dest.HostPort())
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if dest.Scheme == "mqtts" {
+		tlsConn := tls.Client(conn, dest.tlsConfig())
+		if err := tlsConn.Handshake(); err != nil {
+			return errors.New(fmt.Sprintf("TLS handshake failed: %v", err))
+		}
+		InspectTLS(dest, tlsConn.ConnectionState())
+		conn = tlsConn
+	}
+
+	// Brokers disconnect clients that reuse an identifier, so make it unique
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	clientID := "connectivity-" + hex.EncodeToString(suffix)
+
+	if _, err := conn.Write(mqttConnectPacket(clientID, dest.Username, dest.Password, dest.PasswordSet)); err != nil {
+		return err
+	}
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return errors.New(fmt.Sprintf("No CONNACK: %v", err))
+	}
+	if connack[0] != 0x20 || connack[1] != 2 {
+		return errors.New(fmt.Sprintf("Expected CONNACK; received % x", connack))
+	}
+	if code := connack[3]; code != 0 {
+		reason, ok := mqttReturnCodes[code]
+		if !ok {
+			reason = "Unknown return code"
+		}
+		return errors.New(fmt.Sprintf("Connection refused: %s (%d)", reason, code))
+	}
+
+	_, err = conn.Write([]byte{0xe0, 0x00})
+	return err
+}
+
+// Checks that the destination is an MQTT broker that accepts the client's
+// connection.
+func MQTT(dest *Destination) bool {
+	dest.Increment("connectivity.mqtt", []string{})
+	t1 := time.Now()
+	if err := mqttConnect(dest); err != nil {
+		dest.Increment("connectivity.mqtt.error", []string{})
+		LogDestinationError(dest, "Failed MQTT check", err)
+		return false
+	}
+	dest.Timer("connectivity.mqtt", time.Since(t1), []string{})
+	dest.Increment("connectivity.mqtt.success", []string{})
+	return true
+}
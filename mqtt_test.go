@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+type mqttServerOptions struct {
+	tls      bool
+	username string
+	password string
+}
+
+// newMQTTServer answers CONNECT with CONNACK, refusing the wrong credentials,
+// and returns the server's port and tls options trusting its certificate.
+func newMQTTServer(t *testing.T, opts mqttServerOptions) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, opts.tls, func(conn net.Conn, _ *tls.Config) {
+		// Assume a remaining length of less than 128 bytes
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil || header[0] != 0x10 {
+			return
+		}
+		body := make([]byte, header[1])
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		if !bytes.HasPrefix(body, []byte("\x00\x04MQTT\x04")) {
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x01})
+			return
+		}
+
+		flags, payload := body[7], body[10:]
+		readString := func() string {
+			length := binary.BigEndian.Uint16(payload)
+			s := string(payload[2 : 2+length])
+			payload = payload[2+length:]
+			return s
+		}
+		readString() // client identifier
+		var username, password string
+		if flags&0x80 != 0 {
+			username = readString()
+		}
+		if flags&0x40 != 0 {
+			password = readString()
+		}
+
+		code := byte(0)
+		if opts.username != "" && username == "" {
+			code = 5
+		} else if username != opts.username || password != opts.password {
+			code = 4
+		}
+		conn.Write([]byte{0x20, 0x02, 0x00, code})
+		io.ReadFull(conn, header)
+	})
+}
+
+func TestMQTTConnectPacket(t *testing.T) {
+	got := mqttConnectPacket("c", "u", "p", true)
+	want := []byte("\x10\x13\x00\x04MQTT\x04\xc2\x00\x1e\x00\x01c\x00\x01u\x00\x01p")
+	if !bytes.Equal(got, want) {
+		t.Errorf("mqttConnectPacket = %q; want %q", got, want)
+	}
+
+	// A password can't be sent without a username
+	got = mqttConnectPacket("c", "", "p", true)
+	if got[9] != 0x02 {
+		t.Errorf("flags = %#x; want only a clean session", got[9])
+	}
+
+	// Long packets need more than one byte to encode their length
+	got = mqttConnectPacket("c", "u", string(make([]byte, 200)), true)
+	if got[1] != 0x80|(218%128) || got[2] != 218/128 {
+		t.Errorf("remaining length = % x; want 218, encoded in two bytes", got[1:3])
+	}
+}
+
+func TestMQTT(t *testing.T) {
+	cases := []struct {
+		name   string
+		scheme string
+		url    string
+		opts   mqttServerOptions
+		want   string
+	}{
+		{name: "anonymous", scheme: "mqtt", url: "%s"},
+		{name: "credentials", scheme: "mqtt", url: "monitor:secret@%s", opts: mqttServerOptions{username: "monitor", password: "secret"}},
+		{name: "wrong password", scheme: "mqtt", url: "monitor:wrong@%s", opts: mqttServerOptions{username: "monitor", password: "secret"}, want: "Connection refused: Bad user name or password (4)"},
+		{name: "no credentials", scheme: "mqtt", url: "%s", opts: mqttServerOptions{username: "monitor", password: "secret"}, want: "Connection refused: Not authorized (5)"},
+		{name: "tls", scheme: "mqtts", url: "%s", opts: mqttServerOptions{tls: true}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port, config := newMQTTServer(t, tc.opts)
+			dest, err := NewDestination(Url{Label: "mqtt", Url: fmt.Sprintf("%s://%s", tc.scheme, fmt.Sprintf(tc.url, fmt.Sprintf("127.0.0.1:%d", port))), TLS: config})
+			assertNoError(t, "NewDestination", err)
+
+			err = mqttConnect(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if MQTT(dest) {
+					t.Errorf("MQTT = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "mqttConnect", err)
+			if !MQTT(dest) {
+				t.Errorf("MQTT = false; want true")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+type natsServerOptions struct {
+	tls      bool
+	user     string
+	password string
+	token    string
+}
+
+// newNATSServer serves the NATS client protocol up to PONG, returning the
+// server's port and tls options trusting its certificate.
+func newNATSServer(t *testing.T, opts natsServerOptions) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, false, func(conn net.Conn, serverConfig *tls.Config) {
+		info, _ := json.Marshal(map[string]interface{}{
+			"server_id":     "NCXYZ",
+			"server_name":   "nats-0",
+			"version":       "2.10.7",
+			"cluster":       "east",
+			"tls_required":  opts.tls,
+			"auth_required": opts.user != "" || opts.token != "",
+		})
+		fmt.Fprintf(conn, "INFO %s\r\n", info)
+		if opts.tls {
+			tlsConn := tls.Server(conn, serverConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+		}
+
+		r := bufio.NewReader(conn)
+		line, err := r.ReadString('\n')
+		connectJSON, found := strings.CutPrefix(strings.TrimSpace(line), "CONNECT ")
+		if err != nil || !found {
+			fmt.Fprint(conn, "-ERR 'Unknown Protocol Operation'\r\n")
+			return
+		}
+		var connect natsConnect
+		json.Unmarshal([]byte(connectJSON), &connect)
+		if connect.User != opts.user || connect.Pass != opts.password || connect.AuthToken != opts.token {
+			fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+			return
+		}
+
+		// Ping the client first, as servers may
+		fmt.Fprint(conn, "PING\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.TrimSpace(line) == "PING" {
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		}
+	})
+}
+
+func TestNATS(t *testing.T) {
+	cases := []struct {
+		name     string
+		userinfo string
+		opts     natsServerOptions
+		want     string
+	}{
+		{name: "anonymous"},
+		{name: "user and password", userinfo: "monitor:secret@", opts: natsServerOptions{user: "monitor", password: "secret"}},
+		{name: "token", userinfo: "s3cr3t@", opts: natsServerOptions{token: "s3cr3t"}},
+		{name: "wrong password", userinfo: "monitor:wrong@", opts: natsServerOptions{user: "monitor", password: "secret"}, want: "Server error: 'Authorization Violation'"},
+		{name: "no credentials", opts: natsServerOptions{token: "s3cr3t"}, want: "the URL has no credentials"},
+		{name: "tls", userinfo: "s3cr3t@", opts: natsServerOptions{tls: true, token: "s3cr3t"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port, config := newNATSServer(t, tc.opts)
+			dest, err := NewDestination(Url{Label: "nats", Url: fmt.Sprintf("nats://%s127.0.0.1:%d", tc.userinfo, port), TLS: config})
+			assertNoError(t, "NewDestination", err)
+
+			info, err := natsConversation(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if NATS(dest) {
+					t.Errorf("NATS = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "natsConversation", err)
+			if got, want := info.String(), "NATS server 2.10.7 (nats-0) in cluster east"; got != want {
+				t.Errorf("info = %q; want %q", got, want)
+			}
+			if !NATS(dest) {
+				t.Errorf("NATS = false; want true")
+			}
+		})
+	}
+}
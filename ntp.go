@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+This module checks NTP servers, and the local clock against them, because
+clock skew breaks TLS and Kerberos long before anything else notices. An SNTP
+(RFC 4330) query is sent over UDP, and the server must be synchronized: its
+leap indicator must not be the alarm condition, and its stratum must be
+between 1 and max_stratum. The local clock's offset from the server, and the
+round-trip delay, are computed from the query's four timestamps; the check
+fails if the offset is larger than max_offset. For example:
+
+	ntp://time.example.com?max_offset=250ms&max_stratum=3
+
+*/
+
+const DefaultNTPTimeout = 5 * time.Second
+
+const (
+	DefaultNTPMaxOffset  = time.Second
+	DefaultNTPMaxStratum = 15
+)
+
+// Seconds from the NTP epoch (1900) to the Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// NTPCheck describes what an ntp:// destination's server and offset must
+// look like.
+type NTPCheck struct {
+	MaxOffset  time.Duration
+	MaxStratum int
+}
+
+// NTPResult is what an SNTP query learned about the server, and the local
+// clock.
+type NTPResult struct {
+	LeapIndicator int
+	Stratum       int
+	ReferenceID   string
+
+	// How far the local clock is ahead of (negative) or behind (positive)
+	// the server's
+	Offset time.Duration
+
+	// The round-trip delay, excluding the server's processing time
+	Delay time.Duration
+}
+
+// ParseNTPCheck parses the query parameters of an ntp:// URL.
+func ParseNTPCheck(u *url.URL) (*NTPCheck, error) {
+	check := &NTPCheck{MaxOffset: DefaultNTPMaxOffset, MaxStratum: DefaultNTPMaxStratum}
+	query := u.Query()
+	if value := query.Get("max_offset"); value != "" {
+		maxOffset, err := time.ParseDuration(value)
+		if err != nil || maxOffset <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid max_offset (try 500ms): %s", value))
+		}
+		check.MaxOffset = maxOffset
+	}
+	if value := query.Get("max_stratum"); value != "" {
+		maxStratum, err := strconv.Atoi(value)
+		if err != nil || maxStratum < 1 || maxStratum > 15 {
+			return nil, errors.New(fmt.Sprintf("Invalid max_stratum (try 1 to 15): %s", value))
+		}
+		check.MaxStratum = maxStratum
+	}
+	return check, nil
+}
+
+// ntpTimestamp encodes t as a 64-bit NTP timestamp.
+func ntpTimestamp(t time.Time) []byte {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / 1e9
+	return binary.BigEndian.AppendUint64(nil, seconds<<32|fraction)
+}
+
+// ntpTime decodes a 64-bit NTP timestamp.
+func ntpTime(b []byte) time.Time {
+	timestamp := binary.BigEndian.Uint64(b)
+	seconds := int64(timestamp>>32) - ntpEpochOffset
+	nanoseconds := (timestamp & 0xffffffff) * 1e9 >> 32
+	return time.Unix(seconds, int64(nanoseconds))
+}
+
+// ntpQuery sends an SNTP query to the destination, and computes the local
+// clock's offset and the round-trip delay from the response.
+func ntpQuery(dest *Destination) (*NTPResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultNTPTimeout)
+	defer cancel()
+
+	conn, err := dest.DialContext(ctx, "udp", dest.HostPort())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { conn.Close() }()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// Version 4, client mode; the server echoes the transmit timestamp back
+	// as the origin timestamp
+	request := make([]byte, 48)
+	request[0] = 4<<3 | 3
+	t1 := time.Now()
+	copy(request[40:], ntpTimestamp(t1))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 512)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("No response: %v", err))
+		}
+		t4 := time.Now()
+		if n < 48 {
+			return nil, errors.New(fmt.Sprintf("Response of %d bytes is too short", n))
+		}
+		// Ignore stray responses to other (or earlier) queries
+		if !bytes.Equal(response[24:32], request[40:48]) {
+			continue
+		}
+		if mode := response[0] & 0x07; mode != 4 {
+			return nil, errors.New(fmt.Sprintf("Response has mode %d; expected 4 (server)", mode))
+		}
+
+		result := &NTPResult{
+			LeapIndicator: int(response[0] >> 6),
+			Stratum:       int(response[1]),
+			ReferenceID:   ntpReferenceID(response[1], response[12:16]),
+		}
+		t2, t3 := ntpTime(response[32:40]), ntpTime(response[40:48])
+		if binary.BigEndian.Uint64(response[40:48]) == 0 {
+			return result, errors.New("Response has no transmit timestamp")
+		}
+
+		// Take the local clock's readings from t1 to t4 monotonically
+		roundTrip := t4.Sub(t1)
+		result.Offset = (t2.Sub(t1) + t3.Sub(t1.Add(roundTrip))) / 2
+		result.Delay = roundTrip - t3.Sub(t2)
+		return result, nil
+	}
+}
+
+// ntpReferenceID formats a reference ID: a kiss code or clock source (such
+// as GPS) for stratum 0 and 1 servers, or an upstream server's address.
+func ntpReferenceID(stratum byte, id []byte) string {
+	if stratum <= 1 {
+		return strings.TrimRight(string(id), "\x00")
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", id[0], id[1], id[2], id[3])
+}
+
+// validate checks that the server is synchronized, and that the local clock
+// is close enough to it.
+func (c *NTPCheck) validate(result *NTPResult) error {
+	if result.Stratum == 0 {
+		return errors.New(fmt.Sprintf("Server sent a kiss-o'-death: %s", result.ReferenceID))
+	}
+	if result.LeapIndicator == 3 || result.Stratum == 16 {
+		return errors.New("Server clock is unsynchronized")
+	}
+	if result.Stratum > c.MaxStratum {
+		return errors.New(fmt.Sprintf("Stratum %d exceeds max_stratum %d", result.Stratum, c.MaxStratum))
+	}
+	if result.Offset > c.MaxOffset || -result.Offset > c.MaxOffset {
+		return errors.New(fmt.Sprintf("Clock offset %s exceeds max_offset %s", result.Offset.Round(time.Microsecond), c.MaxOffset))
+	}
+	return nil
+}
+
+// Checks that the destination is a synchronized NTP server, and that the
+// local clock agrees with it.
+func NTP(dest *Destination) bool {
+	dest.Increment("connectivity.ntp", []string{})
+	t1 := time.Now()
+	result, err := ntpQuery(dest)
+	if err != nil {
+		dest.Increment("connectivity.ntp.error", []string{})
+		LogDestinationError(dest, "Failed NTP query", err)
+		return false
+	}
+	dest.Timer("connectivity.ntp.delay", result.Delay, []string{})
+	dest.Gauge("connectivity.ntp.offset_ms", int(result.Offset.Milliseconds()), []string{})
+	dest.Gauge("connectivity.ntp.stratum", result.Stratum, []string{})
+	LogDestination(dest, fmt.Sprintf("NTP stratum %d (%s); offset %s, delay %s", result.Stratum, result.ReferenceID, result.Offset.Round(time.Microsecond), result.Delay.Round(time.Microsecond)))
+
+	if err := dest.NTP.validate(result); err != nil {
+		dest.Increment("connectivity.ntp.error", []string{})
+		LogDestinationError(dest, "Failed NTP check", err)
+		return false
+	}
+	dest.Timer("connectivity.ntp", time.Since(t1), []string{})
+	dest.Increment("connectivity.ntp.success", []string{})
+	return true
+}
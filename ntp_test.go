@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type ntpServerOptions struct {
+	leap        byte
+	stratum     byte
+	referenceID string
+	skew        time.Duration
+}
+
+// newNTPServer answers SNTP queries with a clock skew ahead of the local
+// clock, and returns the server's port.
+func newNTPServer(t *testing.T, opts ntpServerOptions) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assertNoError(t, "ListenPacket", err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		request := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			response := make([]byte, 48)
+			response[0] = opts.leap<<6 | 4<<3 | 4
+			response[1] = opts.stratum
+			copy(response[12:16], opts.referenceID)
+			copy(response[24:32], request[40:48])
+			copy(response[32:40], ntpTimestamp(time.Now().Add(opts.skew)))
+			copy(response[40:48], ntpTimestamp(time.Now().Add(opts.skew)))
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestNTPTimestamp(t *testing.T) {
+	want := time.Date(2024, 2, 29, 12, 30, 15, 250000000, time.UTC)
+	if got := ntpTime(ntpTimestamp(want)); !got.Equal(want) {
+		t.Errorf("ntpTime(ntpTimestamp(%s)) = %s", want, got.UTC())
+	}
+}
+
+func TestParseNTPCheck(t *testing.T) {
+	u, _ := url.Parse("ntp://time.example.com?max_offset=250ms&max_stratum=3")
+	check, err := ParseNTPCheck(u)
+	assertNoError(t, "ParseNTPCheck", err)
+	if check.MaxOffset != 250*time.Millisecond || check.MaxStratum != 3 {
+		t.Errorf("check = %+v; want a max_offset of 250ms and max_stratum of 3", check)
+	}
+
+	u, _ = url.Parse("ntp://time.example.com?max_offset=-1s")
+	_, err = ParseNTPCheck(u)
+	assertErrorContains(t, err, "Invalid max_offset")
+
+	u, _ = url.Parse("ntp://time.example.com?max_stratum=16")
+	_, err = ParseNTPCheck(u)
+	assertErrorContains(t, err, "Invalid max_stratum")
+
+	dest, err := NewDestination(Url{Label: "ntp", Url: "ntp://time.example.com"})
+	assertNoError(t, "NewDestination", err)
+	if dest.Port != 123 || dest.Protocol != "udp" || dest.NTP == nil || dest.NTP.MaxOffset != DefaultNTPMaxOffset {
+		t.Errorf("ntp:// port = %d, protocol = %s, check = %+v; want 123, udp and the default NTP check", dest.Port, dest.Protocol, dest.NTP)
+	}
+}
+
+func TestNTP(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		opts  ntpServerOptions
+		want  string
+	}{
+		{name: "synchronized", opts: ntpServerOptions{stratum: 1, referenceID: "GPS"}},
+		{name: "small offset", opts: ntpServerOptions{stratum: 2, skew: 200 * time.Millisecond}},
+		{name: "large offset", opts: ntpServerOptions{stratum: 2, skew: -2 * time.Second}, want: "exceeds max_offset 1s"},
+		{name: "configured offset", query: "?max_offset=100ms", opts: ntpServerOptions{stratum: 2, skew: 200 * time.Millisecond}, want: "exceeds max_offset 100ms"},
+		{name: "unsynchronized", opts: ntpServerOptions{leap: 3, stratum: 2}, want: "Server clock is unsynchronized"},
+		{name: "kiss-o'-death", opts: ntpServerOptions{stratum: 0, referenceID: "RATE"}, want: "kiss-o'-death: RATE"},
+		{name: "stratum", query: "?max_stratum=2", opts: ntpServerOptions{stratum: 3}, want: "Stratum 3 exceeds max_stratum 2"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port := newNTPServer(t, tc.opts)
+			dest, err := NewDestination(Url{Label: "ntp", Url: fmt.Sprintf("ntp://127.0.0.1:%d%s", port, tc.query)})
+			assertNoError(t, "NewDestination", err)
+
+			result, err := ntpQuery(dest)
+			assertNoError(t, "ntpQuery", err)
+			if offset := result.Offset - tc.opts.skew; offset > 50*time.Millisecond || offset < -50*time.Millisecond {
+				t.Errorf("Offset = %s; want about %s", result.Offset, tc.opts.skew)
+			}
+			if result.Delay < 0 || result.Delay > time.Second {
+				t.Errorf("Delay = %s; want a small, positive delay", result.Delay)
+			}
+
+			err = dest.NTP.validate(result)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if NTP(dest) {
+					t.Errorf("NTP = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "validate", err)
+			if !NTP(dest) {
+				t.Errorf("NTP = false; want true")
+			}
+		})
+	}
+
+	t.Run("no response", func(t *testing.T) {
+		dest, err := NewDestination(Url{Label: "ntp", Url: fmt.Sprintf("ntp://127.0.0.1:%d", closedUDPPort(t))})
+		assertNoError(t, "NewDestination", err)
+		_, err = ntpQuery(dest)
+		assertErrorContains(t, err, "No response")
+	})
+}
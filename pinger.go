@@ -1,12 +1,102 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net"
+	"os"
+	"strconv"
+	"time"
 
 	probing "github.com/prometheus-community/pro-bing"
 )
 
+// Without a timeout, a single lost echo would block the pinger forever. Unless
+// a timeout is configured, this is how long to wait for the last echo's reply,
+// after every echo has been sent.
+const DefaultPingTimeout = 10 * time.Second
+
+// PingOptions configure how icmp:// destinations are pinged, and what
+// qualifies as a successful ping. By default, a single echo is sent and it
+// must be answered.
+type PingOptions struct {
+	Count    int           `yaml:"count"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Size     int           `yaml:"size"`
+
+	// The maximum acceptable packet loss, as a percentage. If unset, any
+	// loss short of 100% is acceptable.
+	MaxLoss *float64 `yaml:"max_loss"`
+
+	// Round trip time limits, ignored if unset.
+	MaxAvgRtt time.Duration `yaml:"max_avg_rtt"`
+	MaxRtt    time.Duration `yaml:"max_rtt"`
+
+	// Ping using raw sockets (requiring CAP_NET_RAW) rather than unprivileged
+	// UDP sockets.
+	Privileged *bool `yaml:"privileged"`
+
+	// If set, and this process is not permitted to ping, dial this TCP port
+	// instead.
+	FallbackPort int `yaml:"fallback_port"`
+}
+
+func (o PingOptions) Validate() error {
+	if o.Count < 0 || o.Interval < 0 || o.Timeout < 0 || o.Size < 0 || o.MaxAvgRtt < 0 || o.MaxRtt < 0 {
+		return errors.New("ping options must not be negative")
+	}
+	if o.FallbackPort < 0 || o.FallbackPort > 65535 {
+		return errors.New("fallback_port must be a valid TCP port")
+	}
+	if o.MaxLoss != nil && (*o.MaxLoss < 0 || *o.MaxLoss >= 100) {
+		return errors.New("max_loss must be a percentage from 0 up to (but not including) 100")
+	}
+	return nil
+}
+
+func (o PingOptions) privileged() bool {
+	return o.Privileged != nil && *o.Privileged
+}
+
+func (o PingOptions) configure(pinger *probing.Pinger) {
+	pinger.SetPrivileged(o.privileged())
+	pinger.Count = 1
+	if o.Count > 0 {
+		pinger.Count = o.Count
+	}
+	if o.Interval > 0 {
+		pinger.Interval = o.Interval
+	}
+	pinger.Timeout = time.Duration(pinger.Count-1)*pinger.Interval + DefaultPingTimeout
+	if o.Timeout > 0 {
+		pinger.Timeout = o.Timeout
+	}
+	if o.Size > 0 {
+		pinger.Size = o.Size
+	}
+}
+
+// Evaluate checks the statistics of a completed ping against the pass
+// criteria, returning an error describing the first criterion not met.
+func (o PingOptions) Evaluate(stats *probing.Statistics) error {
+	if stats.PacketsRecv == 0 {
+		return errors.New(fmt.Sprintf("No replies to %d packets", stats.PacketsSent))
+	}
+	if o.MaxLoss != nil && stats.PacketLoss > *o.MaxLoss {
+		return errors.New(fmt.Sprintf("Packet loss of %.1f%% exceeds %g%%", stats.PacketLoss, *o.MaxLoss))
+	}
+	if o.MaxAvgRtt > 0 && stats.AvgRtt > o.MaxAvgRtt {
+		return errors.New(fmt.Sprintf("Average round trip time of %s exceeds %s", stats.AvgRtt, o.MaxAvgRtt))
+	}
+	if o.MaxRtt > 0 && stats.MaxRtt > o.MaxRtt {
+		return errors.New(fmt.Sprintf("Maximum round trip time of %s exceeds %s", stats.MaxRtt, o.MaxRtt))
+	}
+	return nil
+}
+
 func Ping(route *Route, dest *Destination, ip net.IP) bool {
 	pinger, err := probing.NewPinger(ip.String())
 	if err != nil {
@@ -14,8 +104,20 @@ func Ping(route *Route, dest *Destination, ip net.IP) bool {
 		LogRouteError(route, fmt.Sprintf("Failed to setup ping to %s", ip.String()), err)
 		return false
 	}
-	pinger.Count = 1
+	dest.Ping.configure(pinger)
+	if dest.Bind != nil {
+		pinger.Source = dest.Bind.IP.String()
+	}
 	err = pinger.Run()
+	if err != nil && errors.Is(err, os.ErrPermission) {
+		if diagnosis := CheckPingPermission(dest.Ping.privileged()); diagnosis != nil {
+			err = diagnosis
+		}
+		if dest.Ping.FallbackPort != 0 {
+			LogRouteError(route, fmt.Sprintf("Unable to ping %s, falling back to TCP port %d", ip.String(), dest.Ping.FallbackPort), err)
+			return PingFallback(route, dest, ip)
+		}
+	}
 	if err != nil {
 		dest.Increment("connectivity.icmp.error", []string{})
 		LogRouteError(route, fmt.Sprintf("Failed to ping %s", ip.String()), err)
@@ -24,8 +126,48 @@ func Ping(route *Route, dest *Destination, ip net.IP) bool {
 
 	// Emit metrics
 	stats := pinger.Statistics()
+	dest.Gauge("connectivity.icmp.loss", int(math.Round(stats.PacketLoss)), []string{})
+	if stats.PacketsRecv > 0 {
+		dest.Timer("connectivity.icmp", stats.AvgRtt, []string{})
+		dest.Timer("connectivity.icmp.min", stats.MinRtt, []string{})
+		dest.Timer("connectivity.icmp.max", stats.MaxRtt, []string{})
+		dest.Timer("connectivity.icmp.stddev", stats.StdDevRtt, []string{})
+	}
+
+	err = dest.Ping.Evaluate(stats)
+	if err != nil {
+		dest.Increment("connectivity.icmp.error", []string{})
+		LogRouteDestinationError(route, dest, fmt.Sprintf("Failed to ping %s", ip.String()), err)
+		return false
+	}
 	dest.Increment("connectivity.icmp.success", []string{})
-	dest.Timer("connectivity.icmp", stats.AvgRtt, []string{})
 
 	return true
 }
+
+// PingFallback substitutes a TCP connect probe for a ping, for hosts where
+// this process isn't permitted to send ICMP.
+func PingFallback(route *Route, dest *Destination, ip net.IP) bool {
+	metricTags := []string{fmt.Sprintf("dest_ip:%s", ip.String())}
+	hostPort := net.JoinHostPort(ip.String(), strconv.Itoa(dest.Ping.FallbackPort))
+
+	timeout := DefaultPingTimeout
+	if dest.Ping.Timeout > 0 {
+		timeout = dest.Ping.Timeout
+	}
+
+	dest.Increment("connectivity.icmp.fallback", metricTags)
+	t1 := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := dest.dial(ctx, "tcp", hostPort)
+	if err != nil {
+		dest.Increment("connectivity.icmp.fallback.error", metricTags)
+		LogRouteDestinationError(route, dest, fmt.Sprintf("Failed to connect to %s", hostPort), err)
+		return false
+	}
+	defer conn.Close()
+	dest.Timer("connectivity.icmp.fallback", time.Since(t1), metricTags)
+	dest.Increment("connectivity.icmp.fallback.success", metricTags)
+	return true
+}
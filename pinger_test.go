@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	probing "github.com/prometheus-community/pro-bing"
+)
+
+func TestPingOptions_ConfigureDefaults(t *testing.T) {
+	pinger := probing.New("127.0.0.1")
+	PingOptions{}.configure(pinger)
+	if pinger.Count != 1 {
+		t.Errorf("Count = %d; want 1", pinger.Count)
+	}
+	if pinger.Timeout != DefaultPingTimeout {
+		t.Errorf("Timeout = %v; want %v", pinger.Timeout, DefaultPingTimeout)
+	}
+	if pinger.Interval != time.Second {
+		t.Errorf("Interval = %v; want pro-bing's default of 1s", pinger.Interval)
+	}
+}
+
+func TestPingOptions_ConfigureDefaultTimeoutCoversCount(t *testing.T) {
+	pinger := probing.New("127.0.0.1")
+	PingOptions{Count: 20}.configure(pinger)
+	if want := 19*time.Second + DefaultPingTimeout; pinger.Timeout != want {
+		t.Errorf("Timeout = %v; want %v, to send all 20 echoes a second apart", pinger.Timeout, want)
+	}
+
+	pinger = probing.New("127.0.0.1")
+	PingOptions{Count: 5, Interval: 200 * time.Millisecond}.configure(pinger)
+	if want := 800*time.Millisecond + DefaultPingTimeout; pinger.Timeout != want {
+		t.Errorf("Timeout = %v; want %v", pinger.Timeout, want)
+	}
+}
+
+func TestPingOptions_ConfigureOverrides(t *testing.T) {
+	pinger := probing.New("127.0.0.1")
+	PingOptions{Count: 5, Interval: 200 * time.Millisecond, Timeout: 3 * time.Second, Size: 120}.configure(pinger)
+	if pinger.Count != 5 || pinger.Interval != 200*time.Millisecond || pinger.Timeout != 3*time.Second || pinger.Size != 120 {
+		t.Errorf("pinger = {Count: %d, Interval: %v, Timeout: %v, Size: %d}; want {5, 200ms, 3s, 120}", pinger.Count, pinger.Interval, pinger.Timeout, pinger.Size)
+	}
+}
+
+func TestPingOptions_Evaluate(t *testing.T) {
+	maxLoss := 20.0
+	healthy := probing.Statistics{PacketsSent: 10, PacketsRecv: 9, PacketLoss: 10, AvgRtt: 5 * time.Millisecond, MaxRtt: 9 * time.Millisecond}
+
+	cases := []struct {
+		name    string
+		options PingOptions
+		stats   probing.Statistics
+		substr  string
+	}{
+		{name: "no_replies", stats: probing.Statistics{PacketsSent: 3, PacketLoss: 100}, substr: "No replies to 3 packets"},
+		{name: "loss_above_max", options: PingOptions{MaxLoss: &maxLoss}, stats: probing.Statistics{PacketsSent: 10, PacketsRecv: 7, PacketLoss: 30}, substr: "Packet loss of 30.0% exceeds 20%"},
+		{name: "avg_rtt_above_max", options: PingOptions{MaxAvgRtt: time.Millisecond}, stats: healthy, substr: "Average round trip time of 5ms exceeds 1ms"},
+		{name: "max_rtt_above_max", options: PingOptions{MaxRtt: 8 * time.Millisecond}, stats: healthy, substr: "Maximum round trip time of 9ms exceeds 8ms"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertErrorContains(t, tc.options.Evaluate(&tc.stats), tc.substr)
+		})
+	}
+
+	passing := PingOptions{MaxLoss: &maxLoss, MaxAvgRtt: 5 * time.Millisecond, MaxRtt: 10 * time.Millisecond}
+	assertNoError(t, "Evaluate(healthy)", passing.Evaluate(&healthy))
+	assertNoError(t, "Evaluate(healthy) without criteria", PingOptions{}.Evaluate(&healthy))
+}
+
+func TestPingOptions_Validate(t *testing.T) {
+	tooLossy := 100.0
+	assertErrorContains(t, PingOptions{Count: -1}.Validate(), "negative")
+	assertErrorContains(t, PingOptions{MaxLoss: &tooLossy}.Validate(), "max_loss")
+	assertNoError(t, "PingOptions{}.Validate()", PingOptions{}.Validate())
+}
+
+func TestPingOptions_ConfigurePrivileged(t *testing.T) {
+	privileged := true
+	pinger := probing.New("127.0.0.1")
+	PingOptions{Privileged: &privileged}.configure(pinger)
+	if !pinger.Privileged() {
+		t.Errorf("Privileged() = false; want true")
+	}
+
+	pinger = probing.New("127.0.0.1")
+	PingOptions{}.configure(pinger)
+	if pinger.Privileged() {
+		t.Errorf("Privileged() = true; want unprivileged by default")
+	}
+}
+
+// TestPingLoopbackWithFallback pings loopback with a TCP fallback configured.
+// Whether or not this host permits unprivileged ping, the check succeeds:
+// either the echo is answered, or the fallback reaches the listener.
+func TestPingLoopbackWithFallback(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	dest, err := NewDestination(Url{Label: "loopback", Url: "icmp://127.0.0.1", Ping: PingOptions{Timeout: 2 * time.Second, FallbackPort: port}})
+	assertNoError(t, "NewDestination(icmp://127.0.0.1)", err)
+	ip := net.ParseIP("127.0.0.1")
+	if !Ping(&Route{DestinationIP: ip}, dest, ip) {
+		t.Errorf("Ping(127.0.0.1) = false; want true")
+	}
+}
+
+func TestPingFallbackFailsWhenRefused(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	dest := &Destination{Label: "loopback", Scheme: "icmp", Protocol: "icmp", Host: "127.0.0.1", Port: -1, Ping: PingOptions{FallbackPort: 1, Timeout: time.Second}}
+	ip := net.ParseIP("127.0.0.1")
+	if PingFallback(&Route{DestinationIP: ip}, dest, ip) {
+		t.Errorf("PingFallback(127.0.0.1:1) = true; want false")
+	}
+}
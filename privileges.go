@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/*
+
+This module diagnoses whether this process is allowed to ping. Unprivileged
+(UDP) pings on Linux require our group to be within net.ipv4.ping_group_range,
+while privileged (raw socket) pings require CAP_NET_RAW. Either way, the
+kernel only reports "permission denied", so we explain what to do about it.
+
+*/
+
+const (
+	pingGroupRangePath = "/proc/sys/net/ipv4/ping_group_range"
+	procStatusPath     = "/proc/self/status"
+
+	// The bit representing CAP_NET_RAW in capability sets, per capability.h
+	capNetRaw = 13
+)
+
+// CheckPingPermission returns an actionable error if this process is known
+// to be unable to ping in the given mode, or nil if it should be able to (or
+// if we can't tell, such as on platforms other than Linux).
+func CheckPingPermission(privileged bool) error {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	if privileged {
+		return checkCapNetRaw(procStatusPath)
+	}
+
+	groups, err := os.Getgroups()
+	if err != nil {
+		groups = nil
+	}
+	return checkPingGroupRange(pingGroupRangePath, append(groups, os.Getgid()))
+}
+
+func checkPingGroupRange(path string, groups []int) error {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	fields := strings.Fields(string(f))
+	if len(fields) != 2 {
+		return nil
+	}
+	low, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil
+	}
+	high, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil
+	}
+
+	for _, gid := range groups {
+		if gid >= low && gid <= high {
+			return nil
+		}
+	}
+
+	if low > high {
+		return errors.New(fmt.Sprintf("Unprivileged ping is disabled on this host (net.ipv4.ping_group_range = %d %d). Either allow it with `sysctl -w net.ipv4.ping_group_range=\"0 2147483647\"`, or set `privileged: true` under `ping` and grant CAP_NET_RAW with `setcap cap_net_raw+ep %s`", low, high, executable()))
+	}
+	return errors.New(fmt.Sprintf("Unprivileged ping is not permitted for groups %v (net.ipv4.ping_group_range = %d %d). Either widen the range with `sysctl -w net.ipv4.ping_group_range=\"0 2147483647\"`, or set `privileged: true` under `ping` and grant CAP_NET_RAW with `setcap cap_net_raw+ep %s`", groups, low, high, executable()))
+}
+
+func checkCapNetRaw(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !found {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return nil
+		}
+		if caps&(1<<capNetRaw) == 0 {
+			return errors.New(fmt.Sprintf("Privileged ping requires CAP_NET_RAW. Either run as root, grant it with `setcap cap_net_raw+ep %s`, or set `privileged: false` under `ping` to use unprivileged ping", executable()))
+		}
+		return nil
+	}
+	return nil
+}
+
+func executable() string {
+	path, err := os.Executable()
+	if err != nil {
+		return "connectivity"
+	}
+	return path
+}
+
+// ShowPingPermissions logs a diagnosis for every icmp:// destination that
+// this process is not allowed to ping, noting whether it will fall back to a
+// TCP connect probe instead.
+func ShowPingPermissions(destinations []*Destination) {
+	checked := map[bool]error{}
+	for _, dest := range destinations {
+		if dest.Protocol != "icmp" {
+			continue
+		}
+
+		privileged := dest.Ping.privileged()
+		err, ok := checked[privileged]
+		if !ok {
+			err = CheckPingPermission(privileged)
+			checked[privileged] = err
+		}
+		if err == nil {
+			continue
+		}
+
+		if dest.Ping.FallbackPort != 0 {
+			LogDestinationError(dest, fmt.Sprintf("Will fall back to a TCP connect probe on port %d", dest.Ping.FallbackPort), err)
+		} else {
+			LogDestinationError(dest, "Ping will fail", err)
+		}
+	}
+}
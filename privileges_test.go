@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeProcFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "proc")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("os.WriteFile(%q): %v", path, err)
+	}
+	return path
+}
+
+func TestCheckPingGroupRange(t *testing.T) {
+	cases := []struct {
+		name   string
+		proc   string
+		groups []int
+		substr string
+	}{
+		{name: "everyone", proc: "0\t2147483647\n", groups: []int{1000}},
+		{name: "supplementary_group_in_range", proc: "100\t200\n", groups: []int{1000, 150}},
+		{name: "disabled", proc: "1\t0\n", groups: []int{0}, substr: "Unprivileged ping is disabled"},
+		{name: "outside_range", proc: "100\t200\n", groups: []int{1000}, substr: "not permitted for groups [1000]"},
+		{name: "unparseable_is_unknown", proc: "garbage\n", groups: []int{1000}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkPingGroupRange(writeProcFile(t, tc.proc), tc.groups)
+			if tc.substr == "" {
+				assertNoError(t, tc.name, err)
+			} else {
+				assertErrorContains(t, err, tc.substr)
+				assertErrorContains(t, err, "privileged: true")
+			}
+		})
+	}
+
+	assertNoError(t, "missing file", checkPingGroupRange(filepath.Join(t.TempDir(), "missing"), []int{0}))
+}
+
+func TestCheckCapNetRaw(t *testing.T) {
+	withCap := "Name:\tconnectivity\nCapEff:\t0000000000002000\n"
+	withoutCap := "Name:\tconnectivity\nCapEff:\t0000000000000000\n"
+
+	assertNoError(t, "CAP_NET_RAW", checkCapNetRaw(writeProcFile(t, withCap)))
+	err := checkCapNetRaw(writeProcFile(t, withoutCap))
+	assertErrorContains(t, err, "requires CAP_NET_RAW")
+	assertErrorContains(t, err, "setcap cap_net_raw+ep")
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+This module checks Redis servers: redis:// and rediss:// (Redis over TLS)
+destinations authenticate with the credentials in the URL, if any, and must
+answer PING with PONG. Servers that accept connections but never answer, or
+that reject the credentials, fail the check. Optionally, the server's
+replication role can be checked too, as in:
+
+	redis://:password@cache.example.com?role=master
+
+*/
+
+const DefaultRedisTimeout = 5 * time.Second
+
+// RedisCheck describes what a redis:// or rediss:// destination must look
+// like.
+type RedisCheck struct {
+	// "master" or "replica", if the server's role is checked
+	Role string
+}
+
+// IsRedis reports whether a scheme is checked by RedisCheck.
+func IsRedis(scheme string) bool {
+	return scheme == "redis" || scheme == "rediss"
+}
+
+// ParseRedisCheck parses the query parameters of a redis:// or rediss:// URL.
+func ParseRedisCheck(u *url.URL) (*RedisCheck, error) {
+	check := &RedisCheck{Role: strings.ToLower(u.Query().Get("role"))}
+
+	// Older servers call replicas slaves
+	if check.Role == "slave" {
+		check.Role = "replica"
+	}
+	if check.Role != "" && check.Role != "master" && check.Role != "replica" {
+		return nil, errors.New(fmt.Sprintf("Unsupported role: %s (try master or replica)", check.Role))
+	}
+	return check, nil
+}
+
+// respConn speaks RESP, the Redis serialization protocol.
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRESPConn(conn net.Conn) *respConn {
+	return &respConn{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends a command and reads the reply. Error replies are returned as
+// errors.
+func (c *respConn) do(args ...string) (interface{}, error) {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, cmd); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads a reply, which is a string, an int64, nil, or a slice of
+// any of these.
+func (c *respConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("Empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		reply := make([]interface{}, length)
+		for i := range reply {
+			if reply[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return reply, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unexpected reply: %q", truncateBytes([]byte(line), 64)))
+}
+
+// redisConversation authenticates, pings the server, and checks its role,
+// returning the role if it was checked.
+func redisConversation(dest *Destination) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRedisTimeout)
+	defer cancel()
+
+	conn, err := dest.DialContext(ctx, "tcp", dest.HostPort())
+	if err != nil {
+		return "", err
+	}
+	defer func() { conn.Close() }()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if dest.Scheme == "rediss" {
+		tlsConn := tls.Client(conn, dest.tlsConfig())
+		if err := tlsConn.Handshake(); err != nil {
+			return "", errors.New(fmt.Sprintf("TLS handshake failed: %v", err))
+		}
+		InspectTLS(dest, tlsConn.ConnectionState())
+		conn = tlsConn
+	}
+	c := newRESPConn(conn)
+
+	// Servers with ACLs (Redis 6 and later) also take a username
+	if dest.PasswordSet {
+		args := []string{"AUTH", dest.Password}
+		if dest.Username != "" {
+			args = []string{"AUTH", dest.Username, dest.Password}
+		}
+		if _, err := c.do(args...); err != nil {
+			return "", errors.New(fmt.Sprintf("AUTH failed: %v", err))
+		}
+	}
+
+	reply, err := c.do("PING")
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("PING failed: %v", err))
+	} else if reply != "PONG" {
+		return "", errors.New(fmt.Sprintf("PING returned %v; expected PONG", reply))
+	}
+
+	if dest.Redis.Role == "" {
+		return "", nil
+	}
+	reply, err = c.do("ROLE")
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("ROLE failed: %v", err))
+	}
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields) == 0 {
+		return "", errors.New(fmt.Sprintf("ROLE returned %v", reply))
+	}
+	role, _ := fields[0].(string)
+	if role == "slave" {
+		role = "replica"
+	}
+	if role != dest.Redis.Role {
+		return role, errors.New(fmt.Sprintf("Role is %s; expected %s", role, dest.Redis.Role))
+	}
+	return role, nil
+}
+
+// Checks that the destination is a responsive Redis server.
+func Redis(dest *Destination) bool {
+	dest.Increment("connectivity.redis", []string{})
+	t1 := time.Now()
+	role, err := redisConversation(dest)
+	if err != nil {
+		dest.Increment("connectivity.redis.error", []string{})
+		LogDestinationError(dest, "Failed Redis check", err)
+		return false
+	}
+	dest.Timer("connectivity.redis", time.Since(t1), []string{})
+	dest.Increment("connectivity.redis.success", []string{})
+	if role != "" {
+		LogDestination(dest, fmt.Sprintf("Redis role: %s", role))
+	}
+	return true
+}
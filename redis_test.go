@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type redisServerOptions struct {
+	tls      bool
+	username string
+	password string
+	role     string
+}
+
+// newRedisServer serves AUTH, PING and ROLE, returning the server's port and
+// tls options trusting its certificate.
+func newRedisServer(t *testing.T, opts redisServerOptions) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, opts.tls, func(conn net.Conn, _ *tls.Config) {
+		r := bufio.NewReader(conn)
+		authenticated := opts.password == ""
+		for {
+			args, err := readRESPCommand(r)
+			if err != nil {
+				return
+			}
+			switch strings.ToUpper(args[0]) {
+			case "AUTH":
+				username := "default"
+				if len(args) == 3 {
+					username = args[1]
+				}
+				if args[len(args)-1] == opts.password && (opts.username == "" || username == opts.username) {
+					authenticated = true
+					fmt.Fprint(conn, "+OK\r\n")
+				} else {
+					fmt.Fprint(conn, "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+				}
+			case "PING":
+				if !authenticated {
+					fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+				} else {
+					fmt.Fprint(conn, "+PONG\r\n")
+				}
+			case "ROLE":
+				if opts.role == "master" {
+					fmt.Fprint(conn, "*3\r\n$6\r\nmaster\r\n:0\r\n*0\r\n")
+				} else {
+					fmt.Fprintf(conn, "*5\r\n$5\r\nslave\r\n$9\r\n127.0.0.1\r\n:6379\r\n$9\r\nconnected\r\n:0\r\n")
+				}
+			default:
+				fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+			}
+		}
+	})
+}
+
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:length])
+	}
+	return args, nil
+}
+
+func TestParseRedisCheck(t *testing.T) {
+	u, _ := url.Parse("redis://cache.example.com?role=slave")
+	check, err := ParseRedisCheck(u)
+	assertNoError(t, "ParseRedisCheck", err)
+	if check.Role != "replica" {
+		t.Errorf("Role = %q; want replica", check.Role)
+	}
+
+	u, _ = url.Parse("redis://cache.example.com?role=sentinel")
+	_, err = ParseRedisCheck(u)
+	assertErrorContains(t, err, "Unsupported role: sentinel")
+}
+
+func TestRedisDefaultPort(t *testing.T) {
+	for _, scheme := range []string{"redis", "rediss"} {
+		dest, err := NewDestination(Url{Label: scheme, Url: scheme + "://cache.example.com"})
+		assertNoError(t, "NewDestination", err)
+		if dest.Port != 6379 || dest.Redis == nil {
+			t.Errorf("%s:// port = %d, redis = %v; want 6379 and a Redis check", scheme, dest.Port, dest.Redis)
+		}
+	}
+}
+
+func TestRedis(t *testing.T) {
+	cases := []struct {
+		name   string
+		scheme string
+		url    string
+		opts   redisServerOptions
+		want   string
+	}{
+		{name: "ping", scheme: "redis", url: "%s"},
+		{name: "password", scheme: "redis", url: ":secret@%s", opts: redisServerOptions{password: "secret"}},
+		{name: "acl", scheme: "redis", url: "monitor:secret@%s", opts: redisServerOptions{username: "monitor", password: "secret"}},
+		{name: "no password", scheme: "redis", url: "%s", opts: redisServerOptions{password: "secret"}, want: "PING failed: NOAUTH"},
+		{name: "wrong password", scheme: "redis", url: ":wrong@%s", opts: redisServerOptions{password: "secret"}, want: "AUTH failed: WRONGPASS"},
+		{name: "master", scheme: "redis", url: "%s?role=master", opts: redisServerOptions{role: "master"}},
+		{name: "replica", scheme: "redis", url: "%s?role=replica", opts: redisServerOptions{role: "replica"}},
+		{name: "wrong role", scheme: "redis", url: "%s?role=master", opts: redisServerOptions{role: "replica"}, want: "Role is replica; expected master"},
+		{name: "tls", scheme: "rediss", url: ":secret@%s", opts: redisServerOptions{tls: true, password: "secret"}},
+		{name: "tls to plaintext server", scheme: "rediss", url: "%s", want: "TLS handshake failed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port, config := newRedisServer(t, tc.opts)
+			dest, err := NewDestination(Url{Label: "redis", Url: fmt.Sprintf("%s://%s", tc.scheme, fmt.Sprintf(tc.url, fmt.Sprintf("127.0.0.1:%d", port))), TLS: config})
+			assertNoError(t, "NewDestination", err)
+
+			_, err = redisConversation(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if Redis(dest) {
+					t.Errorf("Redis = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "redisConversation", err)
+			if !Redis(dest) {
+				t.Errorf("Redis = false; want true")
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultReportPeriod = 7 * 24 * time.Hour
+
+type Outage struct {
+	Start time.Time
+	End   time.Time
+
+	// True if the destination was still failing at the end of the report
+	Ongoing bool
+}
+
+func (o Outage) Duration() time.Duration {
+	return o.End.Sub(o.Start)
+}
+
+// DestinationReport summarizes the history of a single destination over the
+// report period.
+type DestinationReport struct {
+	Destination string
+	Checks      int
+
+	// Failed checks, including those absorbed by the destination's
+	// thresholds, which aren't outages
+	Failures int
+
+	// Time-weighted uptime, as a percentage of the period the destination
+	// was monitored for.
+	Uptime float64
+
+	// The percentage of the error budget (100 - SLO) consumed by downtime.
+	BudgetBurned float64
+
+	// Percentiles of how long successful checks took (see Result.DurationMs)
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+
+	Outages []Outage
+}
+
+// ParseSince parses a report period. In addition to everything understood by
+// time.ParseDuration, whole days may be given as "7d".
+func ParseSince(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.New(fmt.Sprintf("Invalid number of days: %s", s))
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.New(fmt.Sprintf("Report period must be positive: %s", s))
+	}
+	return d, nil
+}
+
+// BuildReport groups results by destination and summarizes each one with
+// results since the given time; destinations without any are left out.
+// Results must be in chronological order, as they are in the history file,
+// and may go back before since: the last result before since tells whether
+// the period began with an outage. An outage starts with a result that found
+// the destination down or flapping (see Result.Down) and lasts until the next
+// result that didn't (or the end of the period), so that failures absorbed by
+// the destination's thresholds are counted, but don't burn error budget.
+func BuildReport(results []Result, since time.Time, now time.Time, slo float64) []*DestinationReport {
+	byDestination := map[string][]Result{}
+	var names []string
+	for _, r := range results {
+		if r.Time.Before(since) {
+			// Only the last result before the period is needed
+			byDestination[r.Destination] = []Result{r}
+			continue
+		}
+		if previous := byDestination[r.Destination]; len(previous) == 0 || previous[len(previous)-1].Time.Before(since) {
+			names = append(names, r.Destination)
+		}
+		byDestination[r.Destination] = append(byDestination[r.Destination], r)
+	}
+	sort.Strings(names)
+
+	var reports []*DestinationReport
+	for _, name := range names {
+		reports = append(reports, buildDestinationReport(name, byDestination[name], since, now, slo))
+	}
+	return reports
+}
+
+func buildDestinationReport(name string, results []Result, since time.Time, now time.Time, slo float64) *DestinationReport {
+	report := &DestinationReport{Destination: name}
+
+	var durations []time.Duration
+	var outage *Outage
+	for _, r := range results {
+		t := r.Time
+		if t.Before(since) {
+			t = since
+		} else {
+			report.Checks += 1
+			if r.OK {
+				durations = append(durations, r.Duration())
+			} else {
+				report.Failures += 1
+			}
+		}
+
+		if down := r.Down(); !down && outage != nil {
+			outage.End = t
+			report.Outages = append(report.Outages, *outage)
+			outage = nil
+		} else if down && outage == nil {
+			outage = &Outage{Start: t}
+		}
+	}
+
+	// Only count the period the destination was actually monitored for: from
+	// since (or the first check after it) until the next check was due after
+	// the last one (or now, if it isn't due yet)
+	start, end := since, now
+	if first := results[0]; first.Time.After(start) {
+		start = first.Time
+	}
+	if last := results[len(results)-1]; last.Time.Add(last.Interval()).Before(end) {
+		end = last.Time.Add(last.Interval())
+	}
+	if outage != nil {
+		outage.End = end
+		outage.Ongoing = end.Equal(now)
+		report.Outages = append(report.Outages, *outage)
+	}
+	period := end.Sub(start)
+
+	var downtime time.Duration
+	for _, o := range report.Outages {
+		downtime += o.Duration()
+	}
+
+	if period > 0 {
+		report.Uptime = 100 * (1 - float64(downtime)/float64(period))
+	} else if report.Checks > 0 {
+		report.Uptime = 100 * float64(report.Checks-report.Failures) / float64(report.Checks)
+	}
+	report.Uptime = math.Max(0, math.Min(100, report.Uptime))
+	report.BudgetBurned = 100 * (100 - report.Uptime) / (100 - slo)
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	report.P50 = percentile(durations, 50)
+	report.P95 = percentile(durations, 95)
+	report.P99 = percentile(durations, 99)
+
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func PrintReport(w io.Writer, reports []*DestinationReport, since time.Time, slo float64) {
+	fmt.Fprintf(w, "Connectivity since %s (SLO %g%%)\n", since.Format(time.RFC3339), slo)
+	if len(reports) == 0 {
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, "No results recorded.")
+	}
+
+	for _, r := range reports {
+		fmt.Fprintln(w, "")
+		fmt.Fprintf(w, "%s\n", r.Destination)
+		fmt.Fprintf(w, "  Uptime:       %.3f%% (%d checks, %d failed)\n", r.Uptime, r.Checks, r.Failures)
+		fmt.Fprintf(w, "  Error budget: %.1f%% burned\n", r.BudgetBurned)
+		fmt.Fprintf(w, "  Check time:   p50 %s, p95 %s, p99 %s\n", r.P50.Round(time.Millisecond), r.P95.Round(time.Millisecond), r.P99.Round(time.Millisecond))
+		if len(r.Outages) == 0 {
+			fmt.Fprintln(w, "  Outages:      none")
+			continue
+		}
+		fmt.Fprintf(w, "  Outages:      %d\n", len(r.Outages))
+		for _, o := range r.Outages {
+			end := o.End.Format(time.RFC3339)
+			if o.Ongoing {
+				end = "ongoing"
+			}
+			fmt.Fprintf(w, "    %s - %s (%s)\n", o.Start.Format(time.RFC3339), end, o.Duration().Round(time.Second))
+		}
+	}
+}
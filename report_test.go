@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Duration
+	}{
+		{in: "7d", want: 7 * 24 * time.Hour},
+		{in: "1d", want: 24 * time.Hour},
+		{in: "12h", want: 12 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+	}
+	for _, tc := range cases {
+		got, err := ParseSince(tc.in)
+		assertNoError(t, tc.in, err)
+		if got != tc.want {
+			t.Errorf("ParseSince(%q) = %v; want %v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "d", "-1d", "0h", "soon"} {
+		if _, err := ParseSince(in); err == nil {
+			t.Errorf("ParseSince(%q) = nil error; want an error", in)
+		}
+	}
+}
+
+func TestParseReportArgs(t *testing.T) {
+	cases := []struct {
+		args []string
+		want time.Duration
+		ok   bool
+	}{
+		{args: nil, want: DefaultReportPeriod, ok: true},
+		{args: []string{"--since", "2d"}, want: 48 * time.Hour, ok: true},
+		{args: []string{"--since=6h"}, want: 6 * time.Hour, ok: true},
+		{args: []string{"--since"}, ok: false},
+		{args: []string{"--since", "yesterday"}, ok: false},
+		{args: []string{"7d"}, ok: false},
+	}
+	for _, tc := range cases {
+		got, ok := ParseReportArgs(tc.args)
+		if ok != tc.ok || (ok && got != tc.want) {
+			t.Errorf("ParseReportArgs(%q) = (%v, %v); want (%v, %v)", tc.args, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestBuildReport_UptimeOutagesAndCheckTimes(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := since.Add(100 * time.Minute)
+
+	var results []Result
+	for i := 0; i < 100; i++ {
+		results = append(results, Result{
+			Time:        since.Add(time.Duration(i) * time.Minute),
+			Destination: "api",
+			// One 5 minute outage from minute 10 until the success at 15,
+			// and an ongoing outage for the final minute.
+			OK:         !(i >= 10 && i < 15) && i != 99,
+			DurationMs: float64(i + 1),
+		})
+	}
+
+	reports := BuildReport(results, since, now, 99)
+	if len(reports) != 1 {
+		t.Fatalf("len(BuildReport()) = %d; want 1", len(reports))
+	}
+	r := reports[0]
+
+	if r.Checks != 100 || r.Failures != 6 {
+		t.Errorf("Checks, Failures = %d, %d; want 100, 6", r.Checks, r.Failures)
+	}
+	if len(r.Outages) != 2 {
+		t.Fatalf("len(Outages) = %d; want 2 — %+v", len(r.Outages), r.Outages)
+	}
+	if got := r.Outages[0].Duration(); got != 5*time.Minute || r.Outages[0].Ongoing {
+		t.Errorf("Outages[0] = %+v (%v); want a 5m outage that ended", r.Outages[0], got)
+	}
+	if !r.Outages[1].Ongoing || !r.Outages[1].End.Equal(now) {
+		t.Errorf("Outages[1] = %+v; want an ongoing outage ending now", r.Outages[1])
+	}
+
+	// 6 minutes down out of 100
+	if r.Uptime < 93.999 || r.Uptime > 94.001 {
+		t.Errorf("Uptime = %v; want 94", r.Uptime)
+	}
+	if r.BudgetBurned < 599.9 || r.BudgetBurned > 600.1 {
+		t.Errorf("BudgetBurned = %v; want 600", r.BudgetBurned)
+	}
+
+	// Latencies of the 94 successful checks: 1-10, 16-99 ms
+	if r.P50 != 52*time.Millisecond {
+		t.Errorf("P50 = %v; want 52ms", r.P50)
+	}
+	if r.P95 != 95*time.Millisecond {
+		t.Errorf("P95 = %v; want 95ms", r.P95)
+	}
+	if r.P99 != 99*time.Millisecond {
+		t.Errorf("P99 = %v; want 99ms", r.P99)
+	}
+}
+
+func TestBuildReport_GroupsAndSortsDestinations(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []Result{
+		{Time: since.Add(time.Minute), Destination: "b", OK: true},
+		{Time: since.Add(2 * time.Minute), Destination: "a", OK: true},
+		{Time: since.Add(3 * time.Minute), Destination: "b", OK: true},
+	}
+
+	reports := BuildReport(results, since, since.Add(time.Hour), DefaultSLO)
+	if len(reports) != 2 || reports[0].Destination != "a" || reports[1].Destination != "b" {
+		t.Fatalf("BuildReport() destinations = %+v; want [a b]", reports)
+	}
+	if reports[1].Checks != 2 || reports[1].Uptime != 100 || len(reports[1].Outages) != 0 {
+		t.Errorf("reports[b] = %+v; want 2 checks, 100%% uptime and no outages", reports[1])
+	}
+}
+
+func TestBuildReport_SeedsStateFromBeforeThePeriod(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []Result{
+		{Time: since.Add(-time.Hour), Destination: "api", OK: true},
+		{Time: since.Add(-10 * time.Minute), Destination: "api", OK: false},
+		{Time: since.Add(-5 * time.Minute), Destination: "retired", OK: true},
+	}
+	for i := 5; i < 60; i++ {
+		results = append(results, Result{Time: since.Add(time.Duration(i) * time.Minute), Destination: "api", OK: true})
+	}
+
+	reports := BuildReport(results, since, since.Add(time.Hour), DefaultSLO)
+	if len(reports) != 1 || reports[0].Destination != "api" {
+		t.Fatalf("BuildReport() = %+v; want only api, which has results in the period", reports)
+	}
+	r := reports[0]
+	if r.Checks != 55 || r.Failures != 0 {
+		t.Errorf("Checks, Failures = %d, %d; want 55, 0", r.Checks, r.Failures)
+	}
+	// The outage that began before the period lasts until the first success
+	if len(r.Outages) != 1 || !r.Outages[0].Start.Equal(since) || r.Outages[0].Duration() != 5*time.Minute {
+		t.Fatalf("Outages = %+v; want a 5m outage from the start of the period", r.Outages)
+	}
+	if r.Uptime < 91.666 || r.Uptime > 91.667 {
+		t.Errorf("Uptime = %v; want 55 of 60 minutes", r.Uptime)
+	}
+}
+
+func TestBuildReport_ClosesOutagesWhenMonitoringStopped(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []Result{
+		{Time: since, Destination: "api", OK: true, IntervalMs: 60000},
+		{Time: since.Add(time.Minute), Destination: "api", OK: false, IntervalMs: 120000},
+	}
+
+	// The monitor stopped after the failure, long before the report
+	reports := BuildReport(results, since, since.Add(24*time.Hour), DefaultSLO)
+	if len(reports) != 1 {
+		t.Fatalf("len(BuildReport()) = %d; want 1", len(reports))
+	}
+	r := reports[0]
+	if len(r.Outages) != 1 || r.Outages[0].Ongoing || !r.Outages[0].End.Equal(since.Add(3*time.Minute)) {
+		t.Fatalf("Outages = %+v; want an outage that ended when the next check was due", r.Outages)
+	}
+	// 2 of the 3 minutes monitored were down
+	if r.Uptime < 33.333 || r.Uptime > 33.334 {
+		t.Errorf("Uptime = %v; want 33.3", r.Uptime)
+	}
+}
+
+func TestBuildReport_OutagesFollowState(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	states := []struct {
+		ok    bool
+		state string
+	}{
+		{true, "up"},
+		{false, "up"}, // absorbed by failure_threshold
+		{true, "up"},
+		{false, "up"},
+		{false, "down"},
+		{false, "down"},
+		{true, "down"}, // building toward success_threshold
+		{true, "up"},
+		{false, "flapping"},
+		{true, "up"},
+	}
+	var results []Result
+	for i, s := range states {
+		results = append(results, Result{Time: since.Add(time.Duration(i) * time.Minute), Destination: "api", OK: s.ok, State: s.state, IntervalMs: 60000})
+	}
+
+	r := BuildReport(results, since, since.Add(10*time.Minute), DefaultSLO)[0]
+	if r.Checks != 10 || r.Failures != 5 {
+		t.Errorf("Checks, Failures = %d, %d; want every failed check counted", r.Checks, r.Failures)
+	}
+	if len(r.Outages) != 2 || !r.Outages[0].Start.Equal(since.Add(4*time.Minute)) || r.Outages[0].Duration() != 3*time.Minute || r.Outages[1].Duration() != time.Minute {
+		t.Fatalf("Outages = %+v; want 3m down and 1m flapping", r.Outages)
+	}
+	if r.Uptime != 60 {
+		t.Errorf("Uptime = %v; want 60", r.Uptime)
+	}
+}
+
+func TestPrintReport(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	reports := []*DestinationReport{{
+		Destination:  "api",
+		Checks:       10,
+		Failures:     1,
+		Uptime:       99.5,
+		BudgetBurned: 500,
+		P50:          12 * time.Millisecond,
+		P95:          40 * time.Millisecond,
+		P99:          80 * time.Millisecond,
+		Outages:      []Outage{{Start: since, End: since.Add(time.Minute)}},
+	}}
+
+	var buf bytes.Buffer
+	PrintReport(&buf, reports, since, 99.9)
+	got := buf.String()
+	for _, want := range []string{
+		"SLO 99.9%",
+		"api",
+		"99.500% (10 checks, 1 failed)",
+		"500.0% burned",
+		"Check time:   p50 12ms, p95 40ms, p99 80ms",
+		"2026-01-01T00:00:00Z - 2026-01-01T00:01:00Z (1m0s)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("PrintReport() = %q; want it to contain %q", got, want)
+		}
+	}
+}
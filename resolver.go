@@ -1,24 +1,325 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
 	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
 )
 
+// ResolverConfig selects how destination hostnames are resolved. The zero
+// value uses the operating system's resolver.
+type ResolverConfig struct {
+	// Nameservers to query directly, in order, instead of the system
+	// resolver, as host[:port] (port 53 by default), or as URLs such as
+	// tls://host[:port] or https://host[:port]/dns-query.
+	Nameservers []string `yaml:"nameservers"`
+
+	// The transport for nameservers given as host[:port]: "udp" (the
+	// default), "tcp", "tls" or "https".
+	Transport string `yaml:"transport"`
+
+	// Domains appended to names with fewer than Ndots dots before trying the
+	// name as-is, as in resolv.conf(5).
+	Search []string `yaml:"search"`
+	Ndots  int      `yaml:"ndots"`
+
+	Timeout time.Duration `yaml:"timeout"`
+
+	// If set to "warn" or "fail", every nameserver is asked for each host, and
+	// disagreement between their answers is reported (and, if "fail", fails
+	// the lookup).
+	Consistency string `yaml:"consistency"`
+
+	// How the certificates of tls and https nameservers are verified
+	TLS TLSOptions `yaml:"tls"`
+}
+
+// Override pins a host (on a specific port, or any port if Port is 0) to a
+// set of addresses, bypassing DNS entirely.
+type Override struct {
+	Host string
+	Port int
+	IPs  []net.IP
+}
+
+// ParseOverride parses an override in the same format as curl's --resolve
+// option: host:port:addr[,addr]..., where port may be * to match any port.
+func ParseOverride(s string) (Override, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return Override{}, errors.New(fmt.Sprintf("Invalid resolve override (want host:port:addr[,addr]...): %s", s))
+	}
+
+	override := Override{Host: strings.ToLower(parts[0])}
+	if parts[1] != "*" {
+		port, err := strconv.Atoi(parts[1])
+		if err != nil || port <= 0 || port > 65535 {
+			return Override{}, errors.New(fmt.Sprintf("Invalid port in resolve override: %s", s))
+		}
+		override.Port = port
+	}
+
+	for _, addr := range strings.Split(parts[2], ",") {
+		ip := net.ParseIP(strings.Trim(strings.TrimSpace(addr), "[]"))
+		if ip == nil {
+			return Override{}, errors.New(fmt.Sprintf("Invalid address in resolve override: %s", s))
+		}
+		override.IPs = append(override.IPs, ip)
+	}
+	return override, nil
+}
+
+type Resolver struct {
+	Nameservers []Nameserver
+	Search      []string
+	Ndots       int
+	Timeout     time.Duration
+	Overrides   []Override
+	Consistency string
+}
+
+// Resolution describes how a host was resolved.
+type Resolution struct {
+	// The name that was queried, after applying the search list. Empty if no
+	// query was made.
+	Name string
+
+	// "static" for overrides and IP literals, "system" for the operating
+	// system's resolver, or the transport used to reach the nameserver that
+	// answered.
+	Transport string
+
+	// The nameserver that answered, if any
+	Nameserver string
+}
+
+func NewResolver(config ResolverConfig, overrides []string) (*Resolver, error) {
+	r := &Resolver{
+		Search:      config.Search,
+		Ndots:       config.Ndots,
+		Timeout:     config.Timeout,
+		Consistency: strings.ToLower(config.Consistency)}
+
+	transport := strings.ToLower(config.Transport)
+	if transport == "" {
+		transport = "udp"
+	}
+	if _, ok := dnsPorts[transport]; !ok {
+		return nil, errors.New(fmt.Sprintf("Unsupported resolver transport: %s", config.Transport))
+	}
+	if r.Consistency != "" && r.Consistency != "warn" && r.Consistency != "fail" {
+		return nil, errors.New(fmt.Sprintf("Unsupported resolver consistency (want warn or fail): %s", config.Consistency))
+	}
+	if config.Ndots < 0 {
+		return nil, errors.New("ndots must not be negative")
+	}
+	if r.Ndots == 0 {
+		r.Ndots = 1
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = DefaultDNSTimeout
+	}
+
+	tlsConfig, err := NewTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range config.Nameservers {
+		ns, err := ParseNameserver(s, transport)
+		if err != nil {
+			return nil, err
+		}
+		ns.TLSConfig = tlsConfig
+		r.Nameservers = append(r.Nameservers, ns)
+	}
+	if r.Consistency != "" && len(r.Nameservers) == 0 {
+		return nil, errors.New("Resolver consistency can't be checked with the system resolver; configure at least two nameservers")
+	}
+	if r.Consistency != "" && len(r.Nameservers) < 2 {
+		return nil, errors.New(fmt.Sprintf("Resolver consistency requires at least two nameservers to compare: %s", config.Nameservers[0]))
+	}
+
+	for _, s := range overrides {
+		override, err := ParseOverride(s)
+		if err != nil {
+			return nil, err
+		}
+		r.Overrides = append(r.Overrides, override)
+	}
+
+	return r, nil
+}
+
+// The resolver used by destinations that aren't configured otherwise
+var systemResolver = &Resolver{}
+
+// Candidates returns the names to try resolving, in order, applying the
+// search list the same way the system resolver does.
+func (r *Resolver) Candidates(host string) []string {
+	if strings.HasSuffix(host, ".") || len(r.Search) == 0 {
+		return []string{host}
+	}
+
+	var searched []string
+	for _, domain := range r.Search {
+		searched = append(searched, fmt.Sprintf("%s.%s", host, strings.Trim(domain, ".")))
+	}
+	if strings.Count(host, ".") >= r.Ndots {
+		return append([]string{host}, searched...)
+	}
+	return append(searched, host)
+}
+
+// LookupIP resolves host, as it will be dialed on the given port, to a list
+// of IP addresses.
+func (r *Resolver) LookupIP(ctx context.Context, host string, port int) ([]net.IP, error) {
+	ips, _, err := r.lookupIP(ctx, host, port)
+	return ips, err
+}
+
+// lookupIP is LookupIP, but also describes how the host was resolved.
+func (r *Resolver) lookupIP(ctx context.Context, host string, port int) ([]net.IP, Resolution, error) {
+	for _, override := range r.Overrides {
+		if override.Host == strings.ToLower(host) && (override.Port == 0 || override.Port == port) {
+			return override.IPs, Resolution{Transport: "static"}, nil
+		}
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, Resolution{Transport: "static"}, nil
+	}
+
+	resolution := Resolution{Transport: "system"}
+	var err error
+	for _, name := range r.Candidates(host) {
+		var ips []net.IP
+		if len(r.Nameservers) == 0 {
+			resolution.Name = name
+			ips, err = r.lookupSystem(ctx, name)
+		} else {
+			ips, resolution, err = r.query(ctx, name)
+		}
+		if err == nil {
+			return ips, resolution, nil
+		}
+
+		// Only move on to the next candidate if this one doesn't exist
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			break
+		}
+	}
+	return nil, resolution, err
+}
+
+// query asks each nameserver in turn for the A records of name, moving on
+// to the next nameserver if one fails to answer.
+func (r *Resolver) query(ctx context.Context, name string) ([]net.IP, Resolution, error) {
+	resolution := Resolution{Name: name}
+	var lastErr error
+	for _, ns := range r.Nameservers {
+		resolution.Transport = ns.Transport
+		resolution.Nameserver = ns.String()
+		ips, err := r.queryNameserver(ctx, ns, name)
+		if err == nil {
+			return ips, resolution, nil
+		}
+
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, resolution, err
+		}
+		lastErr = err
+	}
+	return nil, resolution, lastErr
+}
+
+// queryNameserver asks a single nameserver for the A records of name.
+func (r *Resolver) queryNameserver(ctx context.Context, ns Nameserver, name string) ([]net.IP, error) {
+	query, err := NewDNSQuery(name, dnsmessage.TypeA)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name}
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+	response, err := ns.Exchange(queryCtx, query)
+	cancel()
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name, Server: ns.String(), IsTimeout: isTimeout(err)}
+	}
+
+	switch response.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+		var ips []net.IP
+		for _, answer := range response.Answers {
+			if a, ok := answer.Body.(*dnsmessage.AResource); ok {
+				ips = append(ips, net.IP(a.A[:]))
+			}
+		}
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: name, Server: ns.String(), IsNotFound: true}
+		}
+		return ips, nil
+	case dnsmessage.RCodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: ns.String(), IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: fmt.Sprintf("server misbehaving (%s)", DNSRCodeString(response.Header.RCode)), Name: name, Server: ns.String()}
+	}
+}
+
+// lookupSystem resolves name with the system resolver, bounded by the
+// resolver's timeout (unset for systemResolver, which relies on the caller's).
+func (r *Resolver) lookupSystem(ctx context.Context, name string) ([]net.IP, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	return net.DefaultResolver.LookupIP(ctx, "ip", name)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (dest *Destination) resolver() *Resolver {
+	if dest.Resolver == nil {
+		return systemResolver
+	}
+	return dest.Resolver
+}
+
 // Perform domain name resolution for a given destination, returning a list of
 // IPs. If resolution is not successful, the list will be empty.
 func Lookup(dest *Destination) ([]net.IP, error) {
 	t1 := time.Now()
-	results, err := net.LookupIP(dest.Host)
+	results, resolution, err := dest.resolver().lookupIP(context.Background(), dest.Host, dest.Port)
 	t2 := time.Now()
-	dest.Timer("connectivity.lookup", t2.Sub(t1), []string{})
+	metricTags := []string{fmt.Sprintf("transport:%s", resolution.Transport)}
+	dest.Timer("connectivity.lookup", t2.Sub(t1), metricTags)
 
 	if err != nil {
-		dest.Increment("connectivity.lookup.error", []string{})
-		return nil, err
+		diagnosis := DiagnoseLookup(context.Background(), dest.resolver(), dest.Host, err)
+		metricTags = append(metricTags, fmt.Sprintf("lookup.error:%s", diagnosis.Class))
+		dest.Increment("connectivity.lookup.error", metricTags)
+		return nil, &LookupError{Err: err, Diagnosis: diagnosis}
+	}
+	if resolution.Nameserver != "" {
+		if err := CheckConsistency(dest, resolution.Name); err != nil {
+			metricTags = append(metricTags, "lookup.error:inconsistent")
+			dest.Increment("connectivity.lookup.error", metricTags)
+			return nil, &LookupError{Err: err, Diagnosis: &LookupDiagnosis{Class: "inconsistent"}}
+		}
 	}
 
-	dest.Increment("connectivity.lookup.success", []string{})
+	dest.Increment("connectivity.lookup.success", metricTags)
 
 	var ips []net.IP
 	for _, ip := range results {
@@ -29,3 +330,31 @@ func Lookup(dest *Destination) ([]net.IP, error) {
 	}
 	return ips, nil
 }
+
+// DialContext connects to address (host:port) using the destination's
+// resolver, so that application-level checks reach the same addresses that
+// were looked up and dialed.
+func (dest *Destination) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := dest.resolver().LookupIP(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = dest.dial(ctx, network, net.JoinHostPort(ip.String(), portString))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 func assertLookupEquals(t *testing.T, got []net.IP, want []net.IP) {
@@ -65,3 +73,181 @@ func TestLookupInvalidHostname(t *testing.T) {
 	assertError(t, "Lookup(a.b.c)", err)
 	assertLenOfResultsInRange(t, got, 0, 0)
 }
+
+func TestParseOverride(t *testing.T) {
+	got, err := ParseOverride("API.example.com:443:192.0.2.10,[2001:db8::10]")
+	assertNoError(t, "ParseOverride", err)
+	if got.Host != "api.example.com" || got.Port != 443 || len(got.IPs) != 2 || got.IPs[1].String() != "2001:db8::10" {
+		t.Errorf("ParseOverride() = %+v; want api.example.com:443 with two addresses", got)
+	}
+
+	got, err = ParseOverride("api.example.com:*:192.0.2.10")
+	assertNoError(t, "ParseOverride(any port)", err)
+	if got.Port != 0 {
+		t.Errorf("ParseOverride(any port).Port = %d; want 0", got.Port)
+	}
+
+	for _, s := range []string{"api.example.com:443", ":443:192.0.2.10", "api.example.com:http:192.0.2.10", "api.example.com:443:nope"} {
+		_, err := ParseOverride(s)
+		assertError(t, s, err)
+	}
+}
+
+func TestResolverCandidates(t *testing.T) {
+	r, err := NewResolver(ResolverConfig{Search: []string{"corp.test", "lab.test."}}, nil)
+	assertNoError(t, "NewResolver", err)
+
+	cases := []struct {
+		host string
+		want string
+	}{
+		{host: "db", want: "db.corp.test db.lab.test db"},
+		{host: "db.eu", want: "db.eu db.eu.corp.test db.eu.lab.test"},
+		{host: "db.", want: "db."},
+	}
+	for _, tc := range cases {
+		if got := strings.Join(r.Candidates(tc.host), " "); got != tc.want {
+			t.Errorf("Candidates(%q) = %q; want %q", tc.host, got, tc.want)
+		}
+	}
+
+	r, _ = NewResolver(ResolverConfig{Search: []string{"corp.test"}, Ndots: 2}, nil)
+	if got := strings.Join(r.Candidates("db.eu"), " "); got != "db.eu.corp.test db.eu" {
+		t.Errorf("Candidates(db.eu) with ndots 2 = %q; want the search domain first", got)
+	}
+}
+
+func TestNewResolverErrors(t *testing.T) {
+	_, err := NewResolver(ResolverConfig{Transport: "sctp"}, nil)
+	assertErrorContains(t, err, "Unsupported resolver transport")
+	_, err = NewResolver(ResolverConfig{}, []string{"bogus"})
+	assertErrorContains(t, err, "Invalid resolve override")
+	_, err = NewResolver(ResolverConfig{Nameservers: []string{":53"}}, nil)
+	assertErrorContains(t, err, "Invalid nameserver")
+	_, err = NewResolver(ResolverConfig{Consistency: "always"}, nil)
+	assertErrorContains(t, err, "Unsupported resolver consistency")
+
+	_, err = NewResolver(ResolverConfig{Consistency: "warn"}, nil)
+	assertErrorContains(t, err, "can't be checked with the system resolver")
+	_, err = NewResolver(ResolverConfig{Consistency: "fail", Nameservers: []string{"192.0.2.53"}}, nil)
+	assertErrorContains(t, err, "requires at least two nameservers to compare: 192.0.2.53")
+	_, err = NewResolver(ResolverConfig{Consistency: "fail", Nameservers: []string{"192.0.2.53", "198.51.100.53"}}, nil)
+	assertNoError(t, "NewResolver", err)
+}
+
+func TestResolverLookupIPViaNameservers(t *testing.T) {
+	server := newTestDNSServer(t,
+		aRecord("app.corp.test", "192.0.2.20"),
+		aRecord("www.example.test", "192.0.2.30"))
+	broken := newTestDNSServer(t)
+	broken.setRCode("*", dnsmessage.RCodeServerFailure)
+
+	for _, transport := range []string{"udp", "tcp"} {
+		t.Run(transport, func(t *testing.T) {
+			r, err := NewResolver(ResolverConfig{
+				// The first nameserver fails, so the second must be used
+				Nameservers: []string{broken.Addr, server.Addr},
+				Transport:   transport,
+				Search:      []string{"corp.test"}}, nil)
+			assertNoError(t, "NewResolver", err)
+
+			got, err := r.LookupIP(context.Background(), "app", 80)
+			assertNoError(t, "LookupIP(app)", err)
+			assertLookupEquals(t, got, []net.IP{net.ParseIP("192.0.2.20")})
+
+			got, err = r.LookupIP(context.Background(), "www.example.test", 80)
+			assertNoError(t, "LookupIP(www.example.test)", err)
+			assertLookupEquals(t, got, []net.IP{net.ParseIP("192.0.2.30")})
+
+			_, err = r.LookupIP(context.Background(), "missing.example.test", 80)
+			var dnsErr *net.DNSError
+			if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+				t.Errorf("LookupIP(missing.example.test) error = %v; want a not found *net.DNSError", err)
+			}
+		})
+	}
+}
+
+func TestResolverLookupIPViaEncryptedNameservers(t *testing.T) {
+	server := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.30"))
+	dotAddr, dohAddr, config := server.serveEncrypted(t)
+
+	for _, nameserver := range []string{"tls://" + dotAddr, "https://" + dohAddr + "/dns-query"} {
+		t.Run(nameserver, func(t *testing.T) {
+			r, err := NewResolver(ResolverConfig{Nameservers: []string{nameserver}, TLS: config}, nil)
+			assertNoError(t, "NewResolver", err)
+
+			got, resolution, err := r.lookupIP(context.Background(), "www.example.test", 443)
+			assertNoError(t, "lookupIP(www.example.test)", err)
+			assertLookupEquals(t, got, []net.IP{net.ParseIP("192.0.2.30")})
+			if resolution.Transport != r.Nameservers[0].Transport {
+				t.Errorf("Transport = %q; want %q", resolution.Transport, r.Nameservers[0].Transport)
+			}
+		})
+	}
+}
+
+func TestLookupReportsTransport(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	server := newTestDNSServer(t, aRecord("www.example.test", "192.0.2.30"))
+	dest, err := NewDestination(Url{
+		Label:    "www",
+		Url:      "https://www.example.test",
+		Resolver: ResolverConfig{Nameservers: []string{server.Addr}, Transport: "tcp"}})
+	assertNoError(t, "NewDestination", err)
+
+	_, err = Lookup(dest)
+	assertNoError(t, "Lookup", err)
+	if got := recvQueue(t); !strings.HasPrefix(got, "connectivity.lookup:") || !strings.Contains(got, "transport:tcp") {
+		t.Errorf("enqueued %q; want a connectivity.lookup timer tagged transport:tcp", got)
+	}
+}
+
+func TestResolverOverrides(t *testing.T) {
+	r, err := NewResolver(ResolverConfig{}, []string{
+		"api.example.test:443:192.0.2.10",
+		"api.example.test:*:192.0.2.99",
+	})
+	assertNoError(t, "NewResolver", err)
+
+	got, err := r.LookupIP(context.Background(), "API.example.test", 443)
+	assertNoError(t, "LookupIP(api.example.test:443)", err)
+	assertLookupEquals(t, got, []net.IP{net.ParseIP("192.0.2.10")})
+
+	got, err = r.LookupIP(context.Background(), "api.example.test", 8443)
+	assertNoError(t, "LookupIP(api.example.test:8443)", err)
+	assertLookupEquals(t, got, []net.IP{net.ParseIP("192.0.2.99")})
+}
+
+// TestResolveOverrideAppliesToEveryStage points an unresolvable hostname at a
+// local HTTP server, as if testing a new load balancer before cutting DNS
+// over. Lookup, Dial and the HTTP request itself must all honor the
+// override.
+func TestResolveOverrideAppliesToEveryStage(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Host, "new-lb.example.test:") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	dest, err := NewDestination(Url{
+		Label:   "new_lb",
+		Url:     fmt.Sprintf("http://new-lb.example.test:%d/", port),
+		Resolve: []string{fmt.Sprintf("new-lb.example.test:%d:127.0.0.1", port)}})
+	assertNoError(t, "NewDestination", err)
+
+	got, err := Lookup(dest)
+	assertNoError(t, "Lookup(new-lb.example.test)", err)
+	assertLookupEquals(t, got, []net.IP{net.ParseIP("127.0.0.1")})
+
+	if !dest.Check() {
+		t.Errorf("Check(%s) = false; want true", dest.URL)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 
 	"github.com/google/gopacket/routing"
 )
@@ -31,6 +32,12 @@ func (r *Route) String() string {
 }
 
 func GetRoute(ip net.IP) (*Route, error) {
+	return GetRouteFrom(ip, nil)
+}
+
+// GetRouteFrom returns the route to ip taken by packets from a specific
+// source address, or the kernel's preferred source if source is nil.
+func GetRouteFrom(ip net.IP, source net.IP) (*Route, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "localhost"
@@ -49,16 +56,53 @@ func GetRoute(ip net.IP) (*Route, error) {
 		return route, err
 	}
 
-	iface, gateway, source, err := r.Route(ip)
+	iface, gateway, preferredSource, err := r.RouteWithSrc(nil, source, ip)
 	if err != nil {
 		// This is possibly a workaround until something like https://github.com/google/gopacket/pull/697 is released
 		return route, err
 	} else {
 		route.SourceInterfaceName = iface.Name
 		route.SourceHardwareAddress = iface.HardwareAddr
-		route.SourceIP = source
+		route.SourceIP = preferredSource
+		if source != nil {
+			route.SourceIP = source
+		}
 		route.GatewayIP = gateway
 		return route, nil
 	}
 
 }
+
+// route returns the route to ip taken by the destination's checks, warning if
+// they're bound to a source that the kernel wouldn't choose itself. Warnings
+// are logged the first time they apply to an address, and again only if they
+// change.
+func (dest *Destination) route(ip net.IP) (*Route, error) {
+	if dest.Bind == nil {
+		return GetRoute(ip)
+	}
+	route, err := GetRouteFrom(ip, dest.Bind.IP)
+	if err != nil {
+		return route, err
+	}
+
+	var warnings []string
+	if preferred, err := GetRoute(ip); err == nil && !preferred.SourceIP.Equal(dest.Bind.IP) {
+		warnings = append(warnings, fmt.Sprintf("%s Bound to %s, but the kernel would send from %s (%s) to reach %s", dest, dest.Bind, preferred.SourceIP, preferred.SourceInterfaceName, ip))
+	}
+	if route.SourceInterfaceName != dest.Bind.Interface {
+		warnings = append(warnings, fmt.Sprintf("%s Packets from %s leave through %s, rather than %s", dest, dest.Bind.IP, route.SourceInterfaceName, dest.Bind.Interface))
+	}
+
+	logged := strings.Join(warnings, "\n")
+	if dest.routeWarnings == nil {
+		dest.routeWarnings = map[string]string{}
+	}
+	if logged != dest.routeWarnings[ip.String()] {
+		for _, warning := range warnings {
+			LogRoute(route, warning)
+		}
+		dest.routeWarnings[ip.String()] = logged
+	}
+	return route, nil
+}
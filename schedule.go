@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// The default monitor schedule ramps from checking every minute to checking
+// every 10 minutes as confidence in a destination grows (see #16).
+const (
+	DefaultMinInterval = 1 * time.Minute
+	DefaultMaxInterval = 10 * time.Minute
+)
+
+// Schedule controls how often Monitor checks a destination. The zero value
+// reproduces the historical 1-10 minute confidence backoff.
+type Schedule struct {
+	// Interval pins the schedule to a fixed period, disabling the ramp.
+	Interval time.Duration `yaml:"interval"`
+
+	// MinInterval and MaxInterval bound the confidence ramp: each consecutive
+	// success adds another MinInterval to the sleep, up to MaxInterval.
+	MinInterval time.Duration `yaml:"min_interval"`
+	MaxInterval time.Duration `yaml:"max_interval"`
+
+	// Jitter adds a random delay in [0, Jitter) to every sleep so that many
+	// destinations (or many hosts) don't probe in lockstep.
+	Jitter time.Duration `yaml:"jitter"`
+
+	// FailingInterval, if set, is used instead of the ramp while the most
+	// recent check failed, so recovery is noticed quickly.
+	FailingInterval time.Duration `yaml:"failing_interval"`
+}
+
+func (s Schedule) Validate() error {
+	if s.Interval < 0 || s.MinInterval < 0 || s.MaxInterval < 0 || s.Jitter < 0 || s.FailingInterval < 0 {
+		return errors.New("intervals must not be negative")
+	}
+	if s.Interval != 0 && (s.MinInterval != 0 || s.MaxInterval != 0) {
+		return errors.New("interval cannot be combined with min_interval or max_interval")
+	}
+	if s.MaxInterval != 0 && s.MinInterval == 0 && s.MaxInterval < DefaultMinInterval {
+		return errors.New(fmt.Sprintf("max_interval must be at least min_interval (default %v)", DefaultMinInterval))
+	}
+	if s.MaxInterval != 0 && s.MinInterval > s.MaxInterval {
+		return errors.New("min_interval must not be greater than max_interval")
+	}
+	return nil
+}
+
+// bounds returns the effective minimum and maximum sleep between checks,
+// applying defaults for anything left unset.
+func (s Schedule) bounds() (time.Duration, time.Duration) {
+	if s.Interval != 0 {
+		return s.Interval, s.Interval
+	}
+
+	min, max := s.MinInterval, s.MaxInterval
+	if min == 0 {
+		min = DefaultMinInterval
+	}
+	if max == 0 {
+		max = DefaultMaxInterval
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// MaxConfidence is the confidence level at which the ramp reaches
+// MaxInterval; there's no point in counting successes beyond it.
+func (s Schedule) MaxConfidence() int {
+	min, max := s.bounds()
+	confidence := int(max / min)
+	if max%min != 0 {
+		confidence += 1
+	}
+	return confidence
+}
+
+// Sleep returns how long to wait before the next check, given the current
+// confidence and whether the last check succeeded. Jitter is not included.
+func (s Schedule) Sleep(confidence int, healthy bool) time.Duration {
+	if !healthy && s.FailingInterval != 0 {
+		return s.FailingInterval
+	}
+
+	min, max := s.bounds()
+	sleep := time.Duration(confidence) * min
+	if sleep > max {
+		sleep = max
+	}
+	return sleep
+}
+
+// Splay returns a random delay in [0, Jitter).
+func (s Schedule) Splay() time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.Jitter)))
+}
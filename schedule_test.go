@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_ZeroValueMatchesHistoricalBackoff(t *testing.T) {
+	var s Schedule
+	if got := s.MaxConfidence(); got != 10 {
+		t.Errorf("MaxConfidence() = %d; want 10", got)
+	}
+	for confidence := 1; confidence <= 10; confidence++ {
+		if got, want := s.Sleep(confidence, true), time.Duration(confidence)*time.Minute; got != want {
+			t.Errorf("Sleep(%d, true) = %v; want %v", confidence, got, want)
+		}
+	}
+	if got, want := s.Sleep(1, false), time.Minute; got != want {
+		t.Errorf("Sleep(1, false) = %v; want %v", got, want)
+	}
+}
+
+func TestSchedule_FixedInterval(t *testing.T) {
+	s := Schedule{Interval: 30 * time.Second}
+	if got := s.MaxConfidence(); got != 1 {
+		t.Errorf("MaxConfidence() = %d; want 1", got)
+	}
+	for _, healthy := range []bool{true, false} {
+		if got, want := s.Sleep(1, healthy), 30*time.Second; got != want {
+			t.Errorf("Sleep(1, %v) = %v; want %v", healthy, got, want)
+		}
+	}
+}
+
+func TestSchedule_CustomRampCapsAtMaxInterval(t *testing.T) {
+	s := Schedule{MinInterval: 20 * time.Second, MaxInterval: 50 * time.Second}
+	if got := s.MaxConfidence(); got != 3 {
+		t.Errorf("MaxConfidence() = %d; want 3", got)
+	}
+	cases := []struct {
+		confidence int
+		want       time.Duration
+	}{
+		{1, 20 * time.Second},
+		{2, 40 * time.Second},
+		{3, 50 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := s.Sleep(tc.confidence, true); got != tc.want {
+			t.Errorf("Sleep(%d, true) = %v; want %v", tc.confidence, got, tc.want)
+		}
+	}
+}
+
+func TestSchedule_FailingIntervalOnlyAppliesWhileFailing(t *testing.T) {
+	s := Schedule{Interval: 5 * time.Minute, FailingInterval: 10 * time.Second}
+	if got, want := s.Sleep(1, false), 10*time.Second; got != want {
+		t.Errorf("Sleep(1, false) = %v; want %v", got, want)
+	}
+	if got, want := s.Sleep(1, true), 5*time.Minute; got != want {
+		t.Errorf("Sleep(1, true) = %v; want %v", got, want)
+	}
+}
+
+func TestSchedule_SplayStaysWithinJitter(t *testing.T) {
+	if got := (Schedule{}).Splay(); got != 0 {
+		t.Errorf("Splay() without jitter = %v; want 0", got)
+	}
+	s := Schedule{Jitter: 10 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if got := s.Splay(); got < 0 || got >= s.Jitter {
+			t.Fatalf("Splay() = %v; want within [0, %v)", got, s.Jitter)
+		}
+	}
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	cases := []struct {
+		name     string
+		schedule Schedule
+		substr   string
+	}{
+		{name: "negative", schedule: Schedule{Jitter: -time.Second}, substr: "negative"},
+		{name: "interval_with_ramp", schedule: Schedule{Interval: time.Minute, MaxInterval: time.Hour}, substr: "cannot be combined"},
+		{name: "min_above_max", schedule: Schedule{MinInterval: time.Hour, MaxInterval: time.Minute}, substr: "greater than max_interval"},
+		{name: "default_min_above_max", schedule: Schedule{MaxInterval: 30 * time.Second}, substr: "max_interval must be at least min_interval (default 1m0s)"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertErrorContains(t, tc.schedule.Validate(), tc.substr)
+		})
+	}
+
+	assertNoError(t, "Schedule{}.Validate()", Schedule{}.Validate())
+	assertNoError(t, "Schedule{MinInterval: 10s}.Validate()", Schedule{MinInterval: 10 * time.Second}.Validate())
+}
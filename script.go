@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+/*
+
+This module runs a small scripted conversation over a tcp:// connection, so
+that a service can be checked for more than accepting connections (which
+Layer 7 firewalls will happily do on its behalf), without writing a new
+scheme for every protocol. For example:
+
+	ssh:
+	  url: tcp://example.com:22
+	  script:
+	    - expect: ^SSH-2\.0-
+
+*/
+
+const DefaultScriptTimeout = 5 * time.Second
+
+// ScriptStep is a single step of a script. Exactly one of Send, SendHex,
+// Expect or TLS must be set.
+type ScriptStep struct {
+	Send    string `yaml:"send"`
+	SendHex string `yaml:"send_hex"`
+
+	// A regular expression that the data received must match
+	Expect string `yaml:"expect"`
+
+	// Upgrade the connection to TLS, as after a STARTTLS command
+	TLS bool `yaml:"tls"`
+
+	Timeout time.Duration `yaml:"timeout"`
+
+	send   []byte
+	expect *regexp.Regexp
+}
+
+func (s ScriptStep) String() string {
+	if s.TLS {
+		return "tls"
+	} else if s.expect != nil {
+		return fmt.Sprintf("expect /%s/", s.expect)
+	}
+	return fmt.Sprintf("send %q", s.send)
+}
+
+type Script struct {
+	Steps []ScriptStep
+
+	// Optional TLS configuration for tls steps
+	TLSConfig *tls.Config
+}
+
+// CompileScript validates the steps of a script, returning nil if there are
+// none.
+func CompileScript(steps []ScriptStep) (*Script, error) {
+	if len(steps) == 0 {
+		return nil, nil
+	}
+
+	script := &Script{}
+	for i, step := range steps {
+		set := 0
+		for _, isSet := range []bool{step.Send != "", step.SendHex != "", step.Expect != "", step.TLS} {
+			if isSet {
+				set += 1
+			}
+		}
+		if set != 1 {
+			return nil, errors.New(fmt.Sprintf("Step %d must set exactly one of send, send_hex, expect or tls", i+1))
+		}
+		if step.Timeout < 0 {
+			return nil, errors.New(fmt.Sprintf("Step %d: timeout must not be negative", i+1))
+		}
+		if step.Timeout == 0 {
+			step.Timeout = DefaultScriptTimeout
+		}
+
+		var err error
+		if step.Send != "" {
+			step.send = []byte(step.Send)
+		} else if step.SendHex != "" {
+			if step.send, err = hex.DecodeString(step.SendHex); err != nil {
+				return nil, errors.New(fmt.Sprintf("Step %d: invalid send_hex: %v", i+1, err))
+			}
+		} else if step.Expect != "" {
+			if step.expect, err = regexp.Compile(step.Expect); err != nil {
+				return nil, errors.New(fmt.Sprintf("Step %d: invalid expect: %v", i+1, err))
+			}
+		}
+		script.Steps = append(script.Steps, step)
+	}
+	return script, nil
+}
+
+// Run executes the script over conn, returning the connection it ended
+// with (which differs from conn after a tls step), and an error describing
+// the step that failed, if any.
+func (s *Script) Run(conn net.Conn, serverName string) (net.Conn, error) {
+	var received []byte
+	for i, step := range s.Steps {
+		conn.SetDeadline(time.Now().Add(step.Timeout))
+
+		var err error
+		if step.TLS {
+			config := &tls.Config{}
+			if s.TLSConfig != nil {
+				config = s.TLSConfig.Clone()
+			}
+			if config.ServerName == "" {
+				config.ServerName = serverName
+			}
+			tlsConn := tls.Client(conn, config)
+			err = tlsConn.Handshake()
+			conn, received = tlsConn, nil
+		} else if step.expect != nil {
+			received, err = expect(conn, received, step.expect)
+		} else {
+			_, err = conn.Write(step.send)
+		}
+
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = errors.New(fmt.Sprintf("timed out after %s", step.Timeout))
+			}
+			if step.expect != nil && len(received) > 0 {
+				err = errors.New(fmt.Sprintf("%v; received %q", err, truncateBytes(received, 128)))
+			}
+			return conn, errors.New(fmt.Sprintf("Step %d (%s): %v", i+1, step, err))
+		}
+	}
+	return conn, nil
+}
+
+// expect reads from conn until the data received (following any left over
+// from previous steps) matches re, returning whatever follows the match.
+func expect(conn net.Conn, received []byte, re *regexp.Regexp) ([]byte, error) {
+	buf := make([]byte, 4096)
+	for {
+		if loc := re.FindIndex(received); loc != nil {
+			return received[loc[1]:], nil
+		}
+		n, err := conn.Read(buf)
+		received = append(received, buf[:n]...)
+		if err != nil {
+			// Give the final read a chance to match
+			if loc := re.FindIndex(received); loc != nil {
+				return received[loc[1]:], nil
+			}
+			return received, err
+		}
+	}
+}
+
+// Connects to a specific IP and runs the destination's script.
+func TCPScript(route *Route, dest *Destination, ip net.IP) bool {
+	metricTags := []string{fmt.Sprintf("dest_ip:%s", ip.String())}
+	hostPort := net.JoinHostPort(ip.String(), strconv.Itoa(dest.Port))
+
+	dest.Increment("connectivity.script", metricTags)
+	t1 := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultScriptTimeout)
+	defer cancel()
+	conn, err := dest.dial(ctx, "tcp", hostPort)
+	if err == nil {
+		conn, err = dest.Script.Run(conn, dest.Host)
+		conn.Close()
+	}
+	if err != nil {
+		dest.Increment("connectivity.script.error", metricTags)
+		LogRouteDestinationError(route, dest, fmt.Sprintf("Script failed against %s", hostPort), err)
+		return false
+	}
+	dest.Timer("connectivity.script", time.Since(t1), metricTags)
+	dest.Increment("connectivity.script.success", metricTags)
+	return true
+}
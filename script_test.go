@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newScriptServer serves a line-based protocol: it greets with a banner,
+// answers PING with PONG, and upgrades to TLS after STARTTLS. It returns the
+// server's port and tls options trusting its certificate.
+func newScriptServer(t *testing.T) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, false, func(conn net.Conn, serverConfig *tls.Config) {
+		fmt.Fprint(conn, "* OK Example server ready\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch strings.TrimSpace(line) {
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case "STARTTLS":
+				fmt.Fprint(conn, "OK begin TLS\r\n")
+				tlsConn := tls.Server(conn, serverConfig)
+				if tlsConn.Handshake() != nil {
+					return
+				}
+				conn = tlsConn
+				r = bufio.NewReader(conn)
+			}
+		}
+	})
+}
+
+func TestCompileScript(t *testing.T) {
+	script, err := CompileScript(nil)
+	if script != nil || err != nil {
+		t.Errorf("CompileScript(nil) = %v, %v; want nil, nil", script, err)
+	}
+
+	script, err = CompileScript([]ScriptStep{{Expect: "^SSH-2\\.0"}, {SendHex: "0d0a", Timeout: time.Second}})
+	assertNoError(t, "CompileScript", err)
+	if script.Steps[0].Timeout != DefaultScriptTimeout || string(script.Steps[1].send) != "\r\n" || script.Steps[1].Timeout != time.Second {
+		t.Errorf("CompileScript = %+v; want default timeouts and decoded hex", script.Steps)
+	}
+
+	cases := []struct {
+		steps  []ScriptStep
+		substr string
+	}{
+		{steps: []ScriptStep{{}}, substr: "Step 1 must set exactly one"},
+		{steps: []ScriptStep{{Send: "a"}, {Send: "b", Expect: "c"}}, substr: "Step 2 must set exactly one"},
+		{steps: []ScriptStep{{Expect: "("}}, substr: "invalid expect"},
+		{steps: []ScriptStep{{SendHex: "xyz"}}, substr: "invalid send_hex"},
+		{steps: []ScriptStep{{Send: "a", Timeout: -time.Second}}, substr: "must not be negative"},
+	}
+	for _, tc := range cases {
+		_, err := CompileScript(tc.steps)
+		assertErrorContains(t, err, tc.substr)
+	}
+}
+
+func TestScriptOnlyForTCP(t *testing.T) {
+	_, err := NewDestination(Url{Label: "script", Url: "https://example.com", Script: []ScriptStep{{Expect: "x"}}})
+	assertErrorContains(t, err, "only supported by tcp://")
+}
+
+func TestTCPScript(t *testing.T) {
+	port, config := newScriptServer(t)
+
+	cases := []struct {
+		name  string
+		steps []ScriptStep
+		want  bool
+	}{
+		{name: "banner", steps: []ScriptStep{{Expect: `^\* OK`}}, want: true},
+		{name: "conversation", steps: []ScriptStep{{Expect: "ready\r\n"}, {Send: "PING\r\n"}, {Expect: "^PONG"}}, want: true},
+		{name: "starttls", steps: []ScriptStep{{Send: "STARTTLS\r\n"}, {Expect: "OK begin TLS\r\n"}, {TLS: true}, {Send: "PING\r\n"}, {Expect: "PONG"}}, want: true},
+		{name: "wrong banner", steps: []ScriptStep{{Expect: "^SSH-2\\.0", Timeout: 50 * time.Millisecond}}, want: false},
+		{name: "no response", steps: []ScriptStep{{Expect: "ready"}, {Send: "HELLO\r\n"}, {Expect: "PONG", Timeout: 50 * time.Millisecond}}, want: false},
+		{name: "tls without starttls", steps: []ScriptStep{{TLS: true, Timeout: 100 * time.Millisecond}}, want: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			dest, err := NewDestination(Url{Label: "script", Url: fmt.Sprintf("tcp://127.0.0.1:%d", port), Script: tc.steps, TLS: config})
+			assertNoError(t, "NewDestination", err)
+			if got := TCPScript(nil, dest, net.ParseIP("127.0.0.1")); got != tc.want {
+				t.Errorf("TCPScript = %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScriptRunReportsFailingStep(t *testing.T) {
+	port, _ := newScriptServer(t)
+	script, err := CompileScript([]ScriptStep{{Expect: "OK"}, {Send: "PING\r\n"}, {Expect: "PANG", Timeout: 50 * time.Millisecond}})
+	assertNoError(t, "CompileScript", err)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	assertNoError(t, "Dial", err)
+	conn, err = script.Run(conn, "127.0.0.1")
+	conn.Close()
+	assertErrorContains(t, err, `Step 3 (expect /PANG/): timed out after 50ms; received " Example server ready\r\nPONG\r\n"`)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+
+This module checks mail relays: smtp:// destinations must offer STARTTLS and
+successfully negotiate it, while smtps:// destinations negotiate TLS
+immediately. Either way, the conversation is:
+
+	220 banner
+	EHLO, listing the server's extensions
+	STARTTLS, and EHLO again (smtp:// only)
+	AUTH, if the URL includes a username
+	QUIT
+
+*/
+
+const DefaultSMTPTimeout = 10 * time.Second
+
+// SMTPExtensions maps the keywords a server lists in response to EHLO to
+// their parameters, such as "SIZE" to "35882577".
+type SMTPExtensions map[string]string
+
+func parseSMTPExtensions(msg string) SMTPExtensions {
+	extensions := SMTPExtensions{}
+
+	// The first line is the server's greeting
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		keyword, params, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if keyword != "" {
+			extensions[strings.ToUpper(keyword)] = params
+		}
+	}
+	return extensions
+}
+
+func (e SMTPExtensions) String() string {
+	var s []string
+	for keyword, params := range e {
+		s = append(s, strings.TrimSpace(keyword+" "+params))
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
+
+// smtpSession is a connection to an SMTP server.
+type smtpSession struct {
+	text *textproto.Conn
+}
+
+func newSMTPSession(conn net.Conn) *smtpSession {
+	return &smtpSession{text: textproto.NewConn(conn)}
+}
+
+// cmd sends a command and reads the response, which must have the expected
+// code.
+func (s *smtpSession) cmd(expectCode int, format string, args ...interface{}) (string, error) {
+	id, err := s.text.Cmd(format, args...)
+	if err != nil {
+		return "", err
+	}
+	s.text.StartResponse(id)
+	defer s.text.EndResponse(id)
+	_, msg, err := s.text.ReadResponse(expectCode)
+	return msg, err
+}
+
+func (s *smtpSession) ehlo() (SMTPExtensions, error) {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		name = "localhost"
+	}
+	msg, err := s.cmd(250, "EHLO %s", name)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("EHLO failed: %v", err))
+	}
+	return parseSMTPExtensions(msg), nil
+}
+
+// auth authenticates using PLAIN or LOGIN, whichever the server supports.
+func (s *smtpSession) auth(extensions SMTPExtensions, username string, password string) error {
+	mechanisms, ok := extensions["AUTH"]
+	if !ok {
+		return errors.New("AUTH is not supported")
+	}
+	mechanismSet := map[string]bool{}
+	for _, m := range strings.Fields(strings.ToUpper(mechanisms)) {
+		mechanismSet[m] = true
+	}
+
+	encode := base64.StdEncoding.EncodeToString
+	var err error
+	if mechanismSet["PLAIN"] {
+		_, err = s.cmd(235, "AUTH PLAIN %s", encode([]byte("\x00"+username+"\x00"+password)))
+	} else if mechanismSet["LOGIN"] {
+		if _, err = s.cmd(334, "AUTH LOGIN"); err == nil {
+			if _, err = s.cmd(334, "%s", encode([]byte(username))); err == nil {
+				_, err = s.cmd(235, "%s", encode([]byte(password)))
+			}
+		}
+	} else {
+		return errors.New(fmt.Sprintf("No supported AUTH mechanism (PLAIN or LOGIN) among: %s", mechanisms))
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("AUTH failed: %v", err))
+	}
+	return nil
+}
+
+// Holds an SMTP conversation with the destination, returning the extensions
+// advertised (after STARTTLS, if negotiated).
+func smtpConversation(dest *Destination) (SMTPExtensions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSMTPTimeout)
+	defer cancel()
+
+	conn, err := dest.DialContext(ctx, "tcp", dest.HostPort())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { conn.Close() }()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if dest.Scheme == "smtps" {
+		tlsConn := tls.Client(conn, dest.tlsConfig())
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, errors.New(fmt.Sprintf("TLS handshake failed: %v", err))
+		}
+		InspectTLS(dest, tlsConn.ConnectionState())
+		conn = tlsConn
+	}
+
+	session := newSMTPSession(conn)
+	if _, _, err := session.text.ReadResponse(220); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unexpected banner: %v", err))
+	}
+	extensions, err := session.ehlo()
+	if err != nil {
+		return nil, err
+	}
+
+	if dest.Scheme == "smtp" {
+		if _, ok := extensions["STARTTLS"]; !ok {
+			return extensions, errors.New(fmt.Sprintf("STARTTLS is not offered (extensions: %s)", extensions))
+		}
+		if _, err := session.cmd(220, "STARTTLS"); err != nil {
+			return extensions, errors.New(fmt.Sprintf("STARTTLS failed: %v", err))
+		}
+		tlsConn := tls.Client(conn, dest.tlsConfig())
+		if err := tlsConn.Handshake(); err != nil {
+			return extensions, errors.New(fmt.Sprintf("TLS handshake failed after STARTTLS: %v", err))
+		}
+		InspectTLS(dest, tlsConn.ConnectionState())
+		conn = tlsConn
+
+		// Extensions may differ once the connection is encrypted
+		session = newSMTPSession(conn)
+		if extensions, err = session.ehlo(); err != nil {
+			return nil, err
+		}
+	}
+
+	if dest.Username != "" {
+		if err := session.auth(extensions, dest.Username, dest.Password); err != nil {
+			return extensions, err
+		}
+	}
+
+	if _, err := session.cmd(221, "QUIT"); err != nil {
+		return extensions, errors.New(fmt.Sprintf("QUIT failed: %v", err))
+	}
+	return extensions, nil
+}
+
+// Checks that the destination is a working mail relay.
+func SMTP(dest *Destination) bool {
+	dest.Increment("connectivity.smtp", []string{})
+	t1 := time.Now()
+	extensions, err := smtpConversation(dest)
+	if err != nil {
+		dest.Increment("connectivity.smtp.error", []string{})
+		LogDestinationError(dest, "Failed SMTP conversation", err)
+		return false
+	}
+	dest.Timer("connectivity.smtp", time.Since(t1), []string{})
+	dest.Increment("connectivity.smtp.success", []string{})
+	LogDestination(dest, fmt.Sprintf("SMTP extensions: %s", extensions))
+	return true
+}
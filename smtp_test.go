@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+type smtpServerOptions struct {
+	// Negotiate TLS before the banner, as for smtps://
+	implicitTLS bool
+
+	offerSTARTTLS bool
+	username      string
+	password      string
+}
+
+// newSMTPServer serves just enough of SMTP for the check to converse with,
+// returning the server's port and tls options trusting its certificate.
+func newSMTPServer(t *testing.T, opts smtpServerOptions) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, false, func(conn net.Conn, serverConfig *tls.Config) {
+		encrypted := opts.implicitTLS
+		if encrypted {
+			tlsConn := tls.Server(conn, serverConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+		}
+
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 mail.example.com ESMTP ready")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				lines := []string{"mail.example.com greets " + arg, "PIPELINING", "SIZE 35882577"}
+				if opts.offerSTARTTLS && !encrypted {
+					lines = append(lines, "STARTTLS")
+				}
+				if encrypted {
+					lines = append(lines, "AUTH PLAIN LOGIN")
+				}
+				for i, l := range lines {
+					sep := "-"
+					if i == len(lines)-1 {
+						sep = " "
+					}
+					text.PrintfLine("250%s%s", sep, l)
+				}
+			case "STARTTLS":
+				text.PrintfLine("220 Go ahead")
+				tlsConn := tls.Server(conn, serverConfig)
+				if tlsConn.Handshake() != nil {
+					return
+				}
+				conn, encrypted = tlsConn, true
+				text = textproto.NewConn(conn)
+			case "AUTH":
+				credentials := base64.StdEncoding.EncodeToString([]byte("\x00" + opts.username + "\x00" + opts.password))
+				if arg == "PLAIN "+credentials {
+					text.PrintfLine("235 Authentication successful")
+				} else {
+					text.PrintfLine("535 Authentication credentials invalid")
+				}
+			case "QUIT":
+				text.PrintfLine("221 Bye")
+				return
+			default:
+				text.PrintfLine("502 Command not implemented")
+			}
+		}
+	})
+}
+
+func TestParseSMTPExtensions(t *testing.T) {
+	extensions := parseSMTPExtensions("mail.example.com greets client\nPIPELINING\nSIZE 35882577\nauth PLAIN LOGIN")
+	if extensions["SIZE"] != "35882577" || extensions["AUTH"] != "PLAIN LOGIN" {
+		t.Errorf("parseSMTPExtensions = %v; want SIZE and AUTH parameters", extensions)
+	}
+	if _, ok := extensions["PIPELINING"]; !ok {
+		t.Errorf("parseSMTPExtensions = %v; want PIPELINING", extensions)
+	}
+	if got, want := extensions.String(), "AUTH PLAIN LOGIN, PIPELINING, SIZE 35882577"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
+
+func TestSMTPSDefaultPort(t *testing.T) {
+	dest, err := NewDestination(Url{Label: "smtps", Url: "smtps://mail.example.com"})
+	assertNoError(t, "NewDestination", err)
+	if dest.Port != 465 {
+		t.Errorf("Port = %d; want 465", dest.Port)
+	}
+}
+
+func TestSMTP(t *testing.T) {
+	cases := []struct {
+		name     string
+		scheme   string
+		userinfo string
+		opts     smtpServerOptions
+		trust    bool
+		want     string
+	}{
+		{name: "starttls", scheme: "smtp", opts: smtpServerOptions{offerSTARTTLS: true}, trust: true},
+		{name: "no starttls", scheme: "smtp", opts: smtpServerOptions{}, trust: true, want: "STARTTLS is not offered"},
+		{name: "untrusted certificate", scheme: "smtp", opts: smtpServerOptions{offerSTARTTLS: true}, want: "TLS handshake failed after STARTTLS"},
+		{name: "auth", scheme: "smtp", userinfo: "user:secret@", opts: smtpServerOptions{offerSTARTTLS: true, username: "user", password: "secret"}, trust: true},
+		{name: "wrong password", scheme: "smtp", userinfo: "user:wrong@", opts: smtpServerOptions{offerSTARTTLS: true, username: "user", password: "secret"}, trust: true, want: "AUTH failed: 535"},
+		{name: "smtps", scheme: "smtps", opts: smtpServerOptions{implicitTLS: true}, trust: true},
+		{name: "smtps auth", scheme: "smtps", userinfo: "user:secret@", opts: smtpServerOptions{implicitTLS: true, username: "user", password: "secret"}, trust: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port, config := newSMTPServer(t, tc.opts)
+			u := Url{Label: "smtp", Url: fmt.Sprintf("%s://%s127.0.0.1:%d", tc.scheme, tc.userinfo, port)}
+			if tc.trust {
+				u.TLS = config
+			}
+			dest, err := NewDestination(u)
+			assertNoError(t, "NewDestination", err)
+
+			extensions, err := smtpConversation(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				return
+			}
+			assertNoError(t, "smtpConversation", err)
+			if _, ok := extensions["AUTH"]; !ok {
+				t.Errorf("extensions = %v; want those advertised over TLS", extensions)
+			}
+			if !SMTP(dest) {
+				t.Errorf("SMTP = false; want true")
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"os"
 	"strings"
@@ -48,3 +50,72 @@ func GetLocalIPs() *Source {
 	}
 	return source
 }
+
+// SourceBinding pins a destination's connections to a local address, on hosts
+// with more than one interface, rather than letting the kernel choose.
+type SourceBinding struct {
+	IP        net.IP
+	Interface string
+}
+
+// NewSourceBinding validates a destination's source_ip and interface options,
+// either of which may be empty. An interface alone binds to its first IPv4
+// address. Without either, it returns nil.
+func NewSourceBinding(sourceIP string, interfaceName string) (*SourceBinding, error) {
+	if sourceIP == "" && interfaceName == "" {
+		return nil, nil
+	}
+	var ip net.IP
+	if sourceIP != "" {
+		if ip = net.ParseIP(sourceIP); ip == nil {
+			return nil, errors.New(fmt.Sprintf("Invalid source_ip: %s", sourceIP))
+		}
+	}
+
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, iface := range interfaces {
+		if interfaceName != "" && iface.Name != interfaceName {
+			continue
+		}
+		found = true
+		addresses, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			ipnet, ok := address.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if (ip == nil && ipnet.IP.To4() != nil) || ipnet.IP.Equal(ip) {
+				return &SourceBinding{IP: ipnet.IP, Interface: iface.Name}, nil
+			}
+		}
+		if interfaceName != "" && ip == nil {
+			return nil, errors.New(fmt.Sprintf("Interface %s has no IPv4 address", interfaceName))
+		}
+	}
+
+	if interfaceName != "" && !found {
+		return nil, errors.New(fmt.Sprintf("No such interface: %s", interfaceName))
+	} else if interfaceName != "" {
+		return nil, errors.New(fmt.Sprintf("%s is not an address of interface %s", ip, interfaceName))
+	}
+	return nil, errors.New(fmt.Sprintf("%s is not a local address", ip))
+}
+
+func (b *SourceBinding) String() string {
+	return fmt.Sprintf("%s (%s)", b.IP, b.Interface)
+}
+
+// localAddr returns the address to bind to when dialing network.
+func (b *SourceBinding) localAddr(network string) net.Addr {
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: b.IP}
+	}
+	return &net.TCPAddr{IP: b.IP}
+}
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +46,108 @@ func TestGetLocalIPs(t *testing.T) {
 	assertValidIPs(t, got)
 	assertLoopbackOnlyReturnedByItself(t, got)
 }
+
+// loopbackInterface returns the name of the interface with 127.0.0.1.
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+	interfaces, err := net.Interfaces()
+	assertNoError(t, "Interfaces", err)
+	for _, iface := range interfaces {
+		addresses, _ := iface.Addrs()
+		for _, address := range addresses {
+			if ipnet, ok := address.(*net.IPNet); ok && ipnet.IP.Equal(net.ParseIP("127.0.0.1")) {
+				return iface.Name
+			}
+		}
+	}
+	t.Skip("No interface has 127.0.0.1")
+	return ""
+}
+
+func TestNewSourceBinding(t *testing.T) {
+	lo := loopbackInterface(t)
+
+	if b, err := NewSourceBinding("", ""); b != nil || err != nil {
+		t.Errorf("NewSourceBinding() = %v, %v; want no binding", b, err)
+	}
+
+	cases := []struct {
+		sourceIP  string
+		iface     string
+		want      string
+		wantError string
+	}{
+		{sourceIP: "127.0.0.1", want: "127.0.0.1 (" + lo + ")"},
+		{iface: lo, want: "127.0.0.1 (" + lo + ")"},
+		{sourceIP: "127.0.0.1", iface: lo, want: "127.0.0.1 (" + lo + ")"},
+		{sourceIP: "localhost", wantError: "Invalid source_ip: localhost"},
+		{sourceIP: "198.51.100.77", wantError: "198.51.100.77 is not a local address"},
+		{sourceIP: "198.51.100.77", iface: lo, wantError: "198.51.100.77 is not an address of interface " + lo},
+		{iface: "nonexistent0", wantError: "No such interface: nonexistent0"},
+	}
+	for _, tc := range cases {
+		b, err := NewSourceBinding(tc.sourceIP, tc.iface)
+		if tc.wantError != "" {
+			assertErrorContains(t, err, tc.wantError)
+			continue
+		}
+		assertNoError(t, "NewSourceBinding", err)
+		if b.String() != tc.want {
+			t.Errorf("NewSourceBinding(%q, %q) = %s; want %s", tc.sourceIP, tc.iface, b, tc.want)
+		}
+	}
+
+	_, err := NewDestination(Url{Label: "bound", Url: "https://example.com", Interface: "nonexistent0"})
+	assertErrorContains(t, err, "Invalid source")
+}
+
+func TestSourceBindingDial(t *testing.T) {
+	loopbackInterface(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, "Listen", err)
+	t.Cleanup(func() { l.Close() })
+
+	dest, err := NewDestination(Url{Label: "bound", Url: "tcp://" + l.Addr().String(), SourceIP: "127.0.0.1"})
+	assertNoError(t, "NewDestination", err)
+	for _, network := range []string{"tcp", "udp"} {
+		conn, err := dest.dial(context.Background(), network, l.Addr().String())
+		assertNoError(t, "dial", err)
+		if host, _, _ := net.SplitHostPort(conn.LocalAddr().String()); host != "127.0.0.1" {
+			t.Errorf("%s LocalAddr = %s; want 127.0.0.1", network, conn.LocalAddr())
+		}
+		conn.Close()
+	}
+}
+
+func TestRouteWarningsAreLoggedOnce(t *testing.T) {
+	lo := loopbackInterface(t)
+	dest, err := NewDestination(Url{Label: "bound", Url: "tcp://192.0.2.1:80", SourceIP: "127.0.0.1"})
+	assertNoError(t, "NewDestination", err)
+
+	var output strings.Builder
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// Bound to loopback, packets for another network can't leave through it
+	ip := net.ParseIP("192.0.2.1")
+	if _, err := dest.route(ip); err != nil {
+		t.Skipf("No route to %s: %v", ip, err)
+	}
+	first := output.String()
+	if !strings.Contains(first, "rather than "+lo) {
+		t.Fatalf("route logged %q; want a warning about the interface", first)
+	}
+
+	output.Reset()
+	dest.route(ip)
+	if output.Len() != 0 {
+		t.Errorf("route logged %q again; want the warnings logged once", output.String())
+	}
+
+	// Changed warnings are logged afresh
+	dest.routeWarnings[ip.String()] = "stale"
+	dest.route(ip)
+	if output.String() != first {
+		t.Errorf("route logged %q after a change; want %q", output.String(), first)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+/*
+
+This module expands SRV-based service discovery into concrete destinations.
+A URL such as srv://_ldap._tcp.example.com (or srv+ldaps://... to choose the
+scheme explicitly) is resolved on every check into one destination per target
+and port, each of which is then checked like any other. Failing to resolve the
+records fails the check, and targets come and go as the records change.
+
+*/
+
+// IsSRV reports whether a URL is to be expanded using SRV records.
+func IsSRV(rawURL string) bool {
+	scheme, _, _ := strings.Cut(strings.ToLower(rawURL), "://")
+	return scheme == "srv" || strings.HasPrefix(scheme, "srv+")
+}
+
+// srvScheme returns the scheme to check SRV targets with: either the one
+// given explicitly (as in srv+https://), or one derived from the service
+// label, such as ldap for _ldap._tcp.example.com. Services over UDP are
+// checked with udp://, since there is nothing more specific to check.
+func srvScheme(scheme string, name string) (string, error) {
+	if explicit, found := strings.CutPrefix(scheme, "srv+"); found && explicit != "" {
+		return explicit, nil
+	}
+
+	labels := strings.SplitN(name, ".", 3)
+	if len(labels) < 3 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return "", errors.New(fmt.Sprintf("SRV names must be of the form _service._proto.name: %s", name))
+	}
+	proto := strings.ToLower(strings.TrimPrefix(labels[1], "_"))
+	if proto == "udp" {
+		return "udp", nil
+	} else if proto != "tcp" {
+		return "", errors.New(fmt.Sprintf("Unsupported SRV protocol: %s", labels[1]))
+	}
+	return strings.ToLower(strings.TrimPrefix(labels[0], "_")), nil
+}
+
+// LookupSRV returns the SRV records for name, ordered by priority (lowest
+// first), and then by weight (highest first).
+func (r *Resolver) LookupSRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	var records []*net.SRV
+	var err error
+	if len(r.Nameservers) == 0 {
+		_, records, err = net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	} else {
+		records, err = r.querySRV(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		if records[i].Weight != records[j].Weight {
+			return records[i].Weight > records[j].Weight
+		}
+		return records[i].Target < records[j].Target
+	})
+	return records, nil
+}
+
+// querySRV asks each nameserver in turn for the SRV records of name.
+func (r *Resolver) querySRV(ctx context.Context, name string) ([]*net.SRV, error) {
+	query, err := NewDNSQuery(name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name}
+	}
+
+	var lastErr error
+	for _, ns := range r.Nameservers {
+		queryCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+		response, err := ns.Exchange(queryCtx, query)
+		cancel()
+		if err != nil {
+			lastErr = &net.DNSError{Err: err.Error(), Name: name, Server: ns.String(), IsTimeout: isTimeout(err)}
+			continue
+		}
+
+		switch response.Header.RCode {
+		case dnsmessage.RCodeSuccess:
+			var records []*net.SRV
+			for _, answer := range response.Answers {
+				if srv, ok := answer.Body.(*dnsmessage.SRVResource); ok {
+					records = append(records, &net.SRV{
+						Target:   srv.Target.String(),
+						Port:     srv.Port,
+						Priority: srv.Priority,
+						Weight:   srv.Weight})
+				}
+			}
+			if len(records) == 0 {
+				return nil, &net.DNSError{Err: "no such host", Name: name, Server: ns.String(), IsNotFound: true}
+			}
+			return records, nil
+		case dnsmessage.RCodeNameError:
+			return nil, &net.DNSError{Err: "no such host", Name: name, Server: ns.String(), IsNotFound: true}
+		default:
+			lastErr = &net.DNSError{Err: fmt.Sprintf("server misbehaving (%s)", DNSRCodeString(response.Header.RCode)), Name: name, Server: ns.String()}
+		}
+	}
+	return nil, lastErr
+}
+
+// SRVExpansion is what an srv:// destination is expanded from.
+type SRVExpansion struct {
+	Url Url
+
+	// The destinations of the last expansion, by URL, so that a target is
+	// only logged when it appears or disappears
+	targets map[string]*Destination
+}
+
+// parseSRV validates an srv:// or srv+<scheme>:// URL, returning it parsed,
+// along with the SRV name and the scheme to check its targets with.
+func parseSRV(u Url) (*url.URL, string, string, error) {
+	parsed, err := url.Parse(u.Url)
+	if err != nil {
+		return nil, "", "", errors.New(fmt.Sprintf("%v: Failed to parse URL: %v", u, err))
+	}
+	name := parsed.Hostname()
+	if name == "" {
+		return nil, "", "", errors.New(fmt.Sprintf("%v: Failed to parse a host in URL: %v", u, u.Url))
+	}
+	if parsed.Port() != "" {
+		return nil, "", "", errors.New(fmt.Sprintf("%v: SRV records determine the port, so none may be given: %v", u, u.Url))
+	}
+	scheme, err := srvScheme(strings.ToLower(parsed.Scheme), name)
+	if err != nil {
+		return nil, "", "", errors.New(fmt.Sprintf("%v: %v", u, err))
+	}
+	return parsed, name, scheme, nil
+}
+
+// srvTarget returns the URL of a single SRV target, which inherits the
+// options of the original, and whose label is suffixed with the target and
+// port.
+func srvTarget(u Url, parsed *url.URL, scheme string, srv *net.SRV) Url {
+	hostPort := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+	target := u
+	target.SRV = srv
+	target.Url = (&url.URL{
+		Scheme:   scheme,
+		User:     parsed.User,
+		Host:     hostPort,
+		Path:     parsed.Path,
+		RawQuery: parsed.RawQuery}).String()
+	if u.Label != "" {
+		target.Label = fmt.Sprintf("%s/%s", u.Label, hostPort)
+	}
+	return target
+}
+
+// NewSRVDestination validates an srv:// or srv+<scheme>:// URL, which is
+// expanded into its targets by every check.
+func NewSRVDestination(u Url) (*Destination, error) {
+	parsed, name, scheme, err := parseSRV(u)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the options against a stand-in target, so that mistakes are
+	// caught at startup rather than by every check
+	standIn, err := NewDestination(srvTarget(u, parsed, scheme, &net.SRV{Target: name, Port: 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	scheme = strings.ToLower(parsed.Scheme)
+	return &Destination{
+		Label:      u.Label,
+		URL:        u.Url,
+		Protocol:   scheme,
+		Scheme:     scheme,
+		Host:       name,
+		Port:       -1,
+		Path:       parsed.Path,
+		Schedule:   u.Schedule,
+		Thresholds: u.Thresholds,
+		Resolver:   standIn.Resolver,
+		Expansion:  &SRVExpansion{Url: u}}, nil
+}
+
+// expandSRV resolves the SRV records of an srv:// or srv+<scheme>:// URL, as
+// parsed by parseSRV, with resolver, returning one URL per target and port
+// (see srvTarget).
+func expandSRV(u Url, parsed *url.URL, name string, scheme string, resolver *Resolver) ([]Url, error) {
+	records, err := resolver.LookupSRV(context.Background(), name)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to resolve SRV records for %s: %v", name, err))
+	}
+
+	// A single target of "." means the service is explicitly unavailable
+	if len(records) == 1 && records[0].Target == "." {
+		return nil, errors.New(fmt.Sprintf("%s is explicitly unavailable (SRV target is \".\")", name))
+	}
+
+	var expanded []Url
+	for _, srv := range records {
+		expanded = append(expanded, srvTarget(u, parsed, scheme, srv))
+	}
+	return expanded, nil
+}
+
+// Resolves the destination's SRV records afresh, and checks every target.
+func CheckSRV(dest *Destination) bool {
+	dest.Increment("connectivity.srv", []string{})
+	parsed, name, scheme, err := parseSRV(dest.Expansion.Url)
+	var expanded []Url
+	if err == nil {
+		expanded, err = expandSRV(dest.Expansion.Url, parsed, name, scheme,
+			// The destination's resolver reaches nameservers through its proxy
+			dest.resolver())
+	}
+	if err != nil {
+		dest.Increment("connectivity.srv.error", []string{})
+		LogDestinationError(dest, "Failed to expand SRV records", err)
+		return false
+	}
+	dest.Increment("connectivity.srv.success", []string{})
+	dest.Gauge("connectivity.srv.targets", len(expanded), []string{})
+
+	// Weights are only meaningful relative to others of the same priority
+	totalWeight := map[uint16]int{}
+	for _, u := range expanded {
+		totalWeight[u.SRV.Priority] += int(u.SRV.Weight)
+	}
+
+	reachable := true
+	targets := map[string]*Destination{}
+	for _, u := range expanded {
+		target, known := dest.Expansion.targets[u.Url]
+		if !known {
+			target, err = NewDestination(u)
+			if err != nil {
+				LogDestinationError(dest, "Invalid SRV target", err)
+				reachable = false
+				continue
+			}
+			share := 100.0
+			if totalWeight[u.SRV.Priority] > 0 {
+				share = 100 * float64(u.SRV.Weight) / float64(totalWeight[u.SRV.Priority])
+			}
+			LogDestination(dest, fmt.Sprintf("Expands to %s (priority %d, weight %d, %.0f%% of priority %d)", u.Url, u.SRV.Priority, u.SRV.Weight, share, u.SRV.Priority))
+		}
+		target.SRV = u.SRV
+		targets[u.Url] = target
+
+		// The target's lines are held back along with the destination's
+		if dest.logs != nil {
+			target.logs = []string{}
+		}
+		reachable = target.Check() && reachable
+		if target.logs != nil {
+			dest.logs = append(dest.logs, target.logs...)
+			target.logs = nil
+		}
+	}
+	for url := range dest.Expansion.targets {
+		if _, ok := targets[url]; !ok {
+			LogDestination(dest, fmt.Sprintf("No longer expands to %s", url))
+		}
+	}
+	dest.Expansion.targets = targets
+	return reachable
+}
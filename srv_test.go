@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSRVScheme(t *testing.T) {
+	cases := []struct {
+		scheme string
+		name   string
+		want   string
+	}{
+		{scheme: "srv", name: "_ldap._tcp.example.test", want: "ldap"},
+		{scheme: "srv", name: "_HTTPS._TCP.example.test", want: "https"},
+		{scheme: "srv", name: "_sip._udp.example.test", want: "udp"},
+		{scheme: "srv+ldaps", name: "_ldap._tcp.example.test", want: "ldaps"},
+		{scheme: "srv+tcp", name: "anything.example.test", want: "tcp"},
+	}
+	for _, tc := range cases {
+		got, err := srvScheme(tc.scheme, tc.name)
+		assertNoError(t, tc.name, err)
+		if got != tc.want {
+			t.Errorf("srvScheme(%s, %s) = %q; want %q", tc.scheme, tc.name, got, tc.want)
+		}
+	}
+
+	_, err := srvScheme("srv", "ldap.example.test")
+	assertErrorContains(t, err, "_service._proto.name")
+	_, err = srvScheme("srv", "_ldap._sctp.example.test")
+	assertErrorContains(t, err, "Unsupported SRV protocol")
+}
+
+func TestIsSRV(t *testing.T) {
+	for url, want := range map[string]bool{
+		"srv://_ldap._tcp.example.test":        true,
+		"SRV+https://_https._tcp.example.test": true,
+		"https://srv.example.test":             false,
+		"srvx://example.test":                  false,
+	} {
+		if got := IsSRV(url); got != want {
+			t.Errorf("IsSRV(%s) = %v; want %v", url, got, want)
+		}
+	}
+}
+
+// expandTestSRV resolves the SRV records of u with its own resolver.
+func expandTestSRV(u Url) ([]Url, error) {
+	parsed, name, scheme, err := parseSRV(u)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := NewResolver(u.Resolver, u.Resolve)
+	if err != nil {
+		return nil, err
+	}
+	return expandSRV(u, parsed, name, scheme, resolver)
+}
+
+func TestExpandSRV(t *testing.T) {
+	server := newTestDNSServer(t,
+		srvRecord("_ldap._tcp.example.test", 20, 0, 389, "backup.example.test"),
+		srvRecord("_ldap._tcp.example.test", 10, 25, 389, "dc2.example.test"),
+		srvRecord("_ldap._tcp.example.test", 10, 75, 3268, "dc1.example.test"))
+
+	u := Url{
+		Label:    "ldap",
+		Url:      "srv+ldaps://_ldap._tcp.example.test/dc=example?scope=base",
+		Resolver: ResolverConfig{Nameservers: []string{server.Addr}}}
+	expanded, err := expandTestSRV(u)
+	assertNoError(t, "expandSRV", err)
+
+	want := []struct {
+		label string
+		url   string
+	}{
+		{label: "ldap/dc1.example.test:3268", url: "ldaps://dc1.example.test:3268/dc=example?scope=base"},
+		{label: "ldap/dc2.example.test:389", url: "ldaps://dc2.example.test:389/dc=example?scope=base"},
+		{label: "ldap/backup.example.test:389", url: "ldaps://backup.example.test:389/dc=example?scope=base"},
+	}
+	if len(expanded) != len(want) {
+		t.Fatalf("len(expandSRV) = %d; want %d", len(expanded), len(want))
+	}
+	for i, got := range expanded {
+		if got.Label != want[i].label || got.Url != want[i].url {
+			t.Errorf("expandSRV[%d] = %s %s; want %s %s", i, got.Label, got.Url, want[i].label, want[i].url)
+		}
+		if got.SRV == nil || len(got.Resolver.Nameservers) != 1 {
+			t.Errorf("expandSRV[%d] = %+v; want the SRV record and the original resolver", i, got)
+		}
+	}
+}
+
+func TestExpandSRVErrors(t *testing.T) {
+	server := newTestDNSServer(t, srvRecord("_imap._tcp.example.test", 0, 0, 0, "."))
+	resolver := ResolverConfig{Nameservers: []string{server.Addr}}
+
+	cases := []struct {
+		url    string
+		substr string
+	}{
+		{url: "srv://_ldap._tcp.example.test:389", substr: "none may be given"},
+		{url: "srv://ldap.example.test", substr: "_service._proto.name"},
+		{url: "srv://_ldap._tcp.missing.example.test", substr: "Failed to resolve SRV records"},
+		{url: "srv://_imap._tcp.example.test", substr: "explicitly unavailable"},
+	}
+	for _, tc := range cases {
+		_, err := expandTestSRV(Url{Label: "srv", Url: tc.url, Resolver: resolver})
+		assertErrorContains(t, err, tc.substr)
+	}
+}
+
+// TestCheckSRV checks an srv:// destination whose records don't exist at
+// first, then point at a local listener, and then at a closed port: the
+// records are resolved afresh by every check, and the target's metrics are
+// tagged with the SRV record's priority and weight.
+func TestCheckSRV(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, "Listen", err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	server := newTestDNSServer(t, aRecord("app.example.test", "127.0.0.1"))
+	dest, err := NewSRVDestination(Url{
+		Label:    "app",
+		Url:      "srv+tcp://_app._tcp.example.test",
+		Resolver: ResolverConfig{Nameservers: []string{server.Addr}}})
+	assertNoError(t, "NewSRVDestination", err)
+
+	// Until the records appear, the check fails rather than the config
+	if dest.Check() {
+		t.Errorf("Check() before the SRV records exist = true; want false")
+	}
+	drainQueue(t)
+
+	server.setRecords(
+		srvRecord("_app._tcp.example.test", 5, 10, uint16(port), "app.example.test"),
+		aRecord("app.example.test", "127.0.0.1"))
+	if !dest.Check() {
+		t.Errorf("Check() = false; want true")
+	}
+	var metrics []string
+	for len(queue) > 0 {
+		metrics = append(metrics, recvQueue(t))
+	}
+	if got := strings.Join(metrics, "\n"); !strings.Contains(got, fmt.Sprintf("dest_label:app/app.example.test-%d", port)) || !strings.Contains(got, "srv_priority:5") || !strings.Contains(got, "srv_weight:10") {
+		t.Errorf("enqueued %q; want the target's metrics tagged with the SRV priority and weight", got)
+	}
+
+	server.setRecords(
+		srvRecord("_app._tcp.example.test", 5, 10, uint16(closedTCPPort(t)), "app.example.test"),
+		aRecord("app.example.test", "127.0.0.1"))
+	if dest.Check() {
+		t.Errorf("Check() after the target moved to a closed port = true; want false")
+	}
+	if len(dest.Expansion.targets) != 1 {
+		t.Errorf("targets = %v; want only the current target", dest.Expansion.targets)
+	}
+}
+
+func TestNewSRVDestination(t *testing.T) {
+	dest, err := NewSRVDestination(Url{Label: "ldap", Url: "srv://_ldap._tcp.example.test"})
+	assertNoError(t, "NewSRVDestination", err)
+	if dest.Expansion == nil || dest.Host != "_ldap._tcp.example.test" {
+		t.Errorf("dest = %+v; want an expansion of _ldap._tcp.example.test", dest)
+	}
+
+	// Options are validated against the targets' scheme at startup
+	_, err = NewSRVDestination(Url{Label: "web", Url: "srv+https://_api._tcp.example.test", SSH: SSHOptions{Fingerprint: "SHA256:x"}})
+	assertErrorContains(t, err, "SSH options are only supported by ssh:// destinations")
+	_, err = NewSRVDestination(Url{Label: "ldap", Url: "srv://_ldap._tcp.example.test:389"})
+	assertErrorContains(t, err, "none may be given")
+}
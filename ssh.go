@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+/*
+
+This module checks SSH servers, such as bastions and git hosts. The check
+reads the server's banner and completes key exchange, verifying the server's
+host key against a pinned fingerprint and/or a known_hosts file. Logging in
+is optional: with a key file, the server must also accept the key for the
+user in the URL. For example:
+
+	bastion:
+	  url: ssh://monitor@bastion.example.com
+	  ssh:
+	    fingerprint: SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s
+	    known_hosts: /etc/ssh/ssh_known_hosts
+	    key_file: /etc/connectivity/id_ed25519
+
+Without either a fingerprint or a known_hosts file, any host key is accepted
+(and logged, so that it can be pinned).
+
+*/
+
+const DefaultSSHTimeout = 10 * time.Second
+
+// SSHOptions configure how an ssh:// destination verifies the server, and
+// whether it logs in.
+type SSHOptions struct {
+	// The SHA256 fingerprint of the host key, as printed by ssh-keygen -l
+	Fingerprint string `yaml:"fingerprint"`
+
+	// A known_hosts file listing the host key
+	KnownHosts string `yaml:"known_hosts"`
+
+	// An unencrypted private key to log in with
+	KeyFile string `yaml:"key_file"`
+}
+
+// SSHCheck is the compiled form of SSHOptions.
+type SSHCheck struct {
+	Fingerprint string
+	KnownHosts  ssh.HostKeyCallback
+	Signer      ssh.Signer
+}
+
+// IsZero reports whether no options were configured.
+func (o SSHOptions) IsZero() bool {
+	return o == SSHOptions{}
+}
+
+// NewSSHCheck validates a destination's SSH options, reading its known_hosts
+// and key files.
+func NewSSHCheck(o SSHOptions, username string) (*SSHCheck, error) {
+	check := &SSHCheck{Fingerprint: o.Fingerprint}
+	if o.Fingerprint != "" && !strings.HasPrefix(o.Fingerprint, "SHA256:") {
+		return nil, errors.New(fmt.Sprintf("Unsupported fingerprint (expected SHA256:...): %s", o.Fingerprint))
+	}
+	if o.KnownHosts != "" {
+		callback, err := knownhosts.New(o.KnownHosts)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid known_hosts: %v", err))
+		}
+		check.KnownHosts = callback
+	}
+	if o.KeyFile != "" {
+		if username == "" {
+			return nil, errors.New("key_file requires a username, as in ssh://user@host")
+		}
+		key, err := os.ReadFile(o.KeyFile)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid key_file: %v", err))
+		}
+		if check.Signer, err = ssh.ParsePrivateKey(key); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid key_file: %s: %v", o.KeyFile, err))
+		}
+	}
+	return check, nil
+}
+
+// verifyHostKey checks the server's host key against the pinned fingerprint
+// and the known_hosts file, if any.
+func (c *SSHCheck) verifyHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if c.Fingerprint != "" {
+		if fingerprint := ssh.FingerprintSHA256(key); fingerprint != c.Fingerprint {
+			return errors.New(fmt.Sprintf("Host key %s %s does not match the pinned fingerprint", key.Type(), fingerprint))
+		}
+	}
+	if c.KnownHosts != nil {
+		if err := c.KnownHosts(hostname, remote, key); err != nil {
+			return errors.New(fmt.Sprintf("Host key %s %s is not known: %v", key.Type(), ssh.FingerprintSHA256(key), err))
+		}
+	}
+	return nil
+}
+
+// sshBannerConn records the server's banner as the SSH library reads it.
+type sshBannerConn struct {
+	net.Conn
+	read   []byte
+	banner string
+}
+
+func (c *sshBannerConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if c.banner == "" && len(c.read) < 8192 {
+		c.read = append(c.read, p[:n]...)
+
+		// Servers may send other lines before the banner itself
+		lines := bytes.Split(c.read, []byte("\n"))
+		for _, line := range lines[:len(lines)-1] {
+			if bytes.HasPrefix(line, []byte("SSH-")) {
+				c.banner = string(bytes.TrimSuffix(line, []byte("\r")))
+				c.read = nil
+				break
+			}
+		}
+	}
+	return n, err
+}
+
+// sshResult describes the server, once its host key has been verified.
+type sshResult struct {
+	Banner   string
+	HostKey  ssh.PublicKey
+	LoggedIn bool
+}
+
+// sshConversation completes key exchange with the destination, and logs in
+// if a key file was configured.
+func sshConversation(dest *Destination) (*sshResult, error) {
+	check := dest.SSH
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSSHTimeout)
+	defer cancel()
+
+	netConn, err := dest.DialContext(ctx, "tcp", dest.HostPort())
+	if err != nil {
+		return nil, err
+	}
+	conn := &sshBannerConn{Conn: netConn}
+	defer func() { conn.Close() }()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	result := &sshResult{}
+	config := &ssh.ClientConfig{
+		User:          dest.Username,
+		ClientVersion: "SSH-2.0-connectivity",
+		Timeout:       DefaultSSHTimeout,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if err := check.verifyHostKey(hostname, remote, key); err != nil {
+				return err
+			}
+			result.HostKey = key
+			return nil
+		},
+	}
+	if check.Signer != nil {
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(check.Signer)}
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, dest.HostPort(), config)
+	result.Banner = conn.banner
+	if err != nil {
+		// Without a key, there's no way to log in, so authentication failing
+		// after a verified key exchange is expected
+		if check.Signer == nil && result.HostKey != nil {
+			return result, nil
+		}
+		if result.Banner == "" {
+			return result, errors.New(fmt.Sprintf("No SSH banner: %v", err))
+		}
+		if result.HostKey != nil {
+			return result, errors.New(fmt.Sprintf("Login as %s failed: %v", dest.Username, err))
+		}
+		return result, err
+	}
+	ssh.NewClient(sshConn, chans, reqs).Close()
+	result.LoggedIn = true
+	return result, nil
+}
+
+// Checks that the destination is an SSH server with the expected host key,
+// which accepts the configured key, if any.
+func SSH(dest *Destination) bool {
+	dest.Increment("connectivity.ssh", []string{})
+	t1 := time.Now()
+	result, err := sshConversation(dest)
+	if err != nil {
+		dest.Increment("connectivity.ssh.error", []string{})
+		LogDestinationError(dest, "Failed SSH check", err)
+		return false
+	}
+	dest.Timer("connectivity.ssh", time.Since(t1), []string{})
+	dest.Increment("connectivity.ssh.success", []string{})
+
+	message := fmt.Sprintf("SSH server: %s; host key %s %s", result.Banner, result.HostKey.Type(), ssh.FingerprintSHA256(result.HostKey))
+	if result.LoggedIn {
+		message += fmt.Sprintf("; logged in as %s", dest.Username)
+	}
+	LogDestination(dest, message)
+	return true
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newSSHKey generates an ed25519 key, returning its signer and the path of
+// its private key, as ssh-keygen would write it.
+func newSSHKey(t *testing.T) (ssh.Signer, string) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assertNoError(t, "GenerateKey", err)
+	signer, err := ssh.NewSignerFromKey(private)
+	assertNoError(t, "NewSignerFromKey", err)
+	block, err := ssh.MarshalPrivateKey(private, "")
+	assertNoError(t, "MarshalPrivateKey", err)
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	assertNoError(t, "WriteFile", os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	return signer, path
+}
+
+// newSSHServer accepts connections with hostKey, letting user log in with
+// authorized, and returns the server's address.
+func newSSHServer(t *testing.T, hostKey ssh.Signer, user string, authorized ssh.PublicKey) string {
+	t.Helper()
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-OpenSSH_9.6",
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == user && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, "Listen", err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer func() { conn.Close() }()
+				sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no channels")
+				}
+				sshConn.Close()
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNewSSHCheck(t *testing.T) {
+	_, err := NewSSHCheck(SSHOptions{Fingerprint: "MD5:16:27:ac:a5"}, "")
+	assertErrorContains(t, err, "Unsupported fingerprint")
+
+	_, keyFile := newSSHKey(t)
+	_, err = NewSSHCheck(SSHOptions{KeyFile: keyFile}, "")
+	assertErrorContains(t, err, "key_file requires a username")
+
+	check, err := NewSSHCheck(SSHOptions{KeyFile: keyFile}, "git")
+	assertNoError(t, "NewSSHCheck", err)
+	if check.Signer == nil {
+		t.Errorf("Signer = nil; want the key file's key")
+	}
+
+	_, err = NewSSHCheck(SSHOptions{KnownHosts: filepath.Join(t.TempDir(), "missing")}, "")
+	assertErrorContains(t, err, "Invalid known_hosts")
+
+	dest, err := NewDestination(Url{Label: "ssh", Url: "ssh://bastion.example.com"})
+	assertNoError(t, "NewDestination", err)
+	if dest.Port != 22 || dest.SSH == nil {
+		t.Errorf("ssh:// port = %d, check = %v; want 22 and an SSH check", dest.Port, dest.SSH)
+	}
+
+	_, err = NewDestination(Url{Label: "web", Url: "https://example.com", SSH: SSHOptions{Fingerprint: "SHA256:x"}})
+	assertErrorContains(t, err, "SSH options are only supported by ssh:// destinations")
+}
+
+func TestSSH(t *testing.T) {
+	hostKey, _ := newSSHKey(t)
+	otherKey, _ := newSSHKey(t)
+	userKey, userKeyFile := newSSHKey(t)
+	_, strangerKeyFile := newSSHKey(t)
+	addr := newSSHServer(t, hostKey, "git", userKey.PublicKey())
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	assertNoError(t, "WriteFile", os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{addr}, hostKey.PublicKey())+"\n"), 0600))
+	otherKnownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	assertNoError(t, "WriteFile", os.WriteFile(otherKnownHosts, []byte(knownhosts.Line([]string{addr}, otherKey.PublicKey())+"\n"), 0600))
+
+	cases := []struct {
+		name     string
+		user     string
+		opts     SSHOptions
+		loggedIn bool
+		want     string
+	}{
+		{name: "any host key"},
+		{name: "fingerprint", opts: SSHOptions{Fingerprint: ssh.FingerprintSHA256(hostKey.PublicKey())}},
+		{name: "wrong fingerprint", opts: SSHOptions{Fingerprint: ssh.FingerprintSHA256(otherKey.PublicKey())}, want: "does not match the pinned fingerprint"},
+		{name: "known hosts", opts: SSHOptions{KnownHosts: knownHosts}},
+		{name: "unknown host key", opts: SSHOptions{KnownHosts: otherKnownHosts}, want: "is not known"},
+		{name: "login", user: "git@", opts: SSHOptions{KnownHosts: knownHosts, KeyFile: userKeyFile}, loggedIn: true},
+		{name: "login refused", user: "git@", opts: SSHOptions{KnownHosts: knownHosts, KeyFile: strangerKeyFile}, want: "Login as git failed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			dest, err := NewDestination(Url{Label: "ssh", Url: fmt.Sprintf("ssh://%s%s", tc.user, addr), SSH: tc.opts})
+			assertNoError(t, "NewDestination", err)
+
+			result, err := sshConversation(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if SSH(dest) {
+					t.Errorf("SSH = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "sshConversation", err)
+			if result.Banner != "SSH-2.0-OpenSSH_9.6" {
+				t.Errorf("Banner = %q; want SSH-2.0-OpenSSH_9.6", result.Banner)
+			}
+			if !bytes.Equal(result.HostKey.Marshal(), hostKey.PublicKey().Marshal()) {
+				t.Errorf("HostKey = %s; want the server's", ssh.FingerprintSHA256(result.HostKey))
+			}
+			if result.LoggedIn != tc.loggedIn {
+				t.Errorf("LoggedIn = %v; want %v", result.LoggedIn, tc.loggedIn)
+			}
+			if !SSH(dest) {
+				t.Errorf("SSH = false; want true")
+			}
+		})
+	}
+}
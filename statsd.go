@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -72,7 +73,7 @@ func StatsdSender(config *Config) {
 
 func statsdSender(config *Config, q <-chan string) {
 	for s := range q {
-		statsdHostPort := fmt.Sprintf("%s:%d", config.StatsdHost, config.StatsdPort)
+		statsdHostPort := net.JoinHostPort(config.StatsdHost, strconv.Itoa(config.StatsdPort))
 		if conn, err := net.Dial(config.StatsdProtocol, statsdHostPort); err == nil {
 			io.WriteString(conn, s)
 			conn.Close()
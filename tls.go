@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Certificates expiring sooner than this are logged as a warning.
+const CertificateExpiryWarning = 14 * 24 * time.Hour
+
+// TLSOptions configure how the server's certificate is verified by checks
+// that negotiate TLS.
+type TLSOptions struct {
+	// A PEM file of CA certificates to trust instead of the system's
+	CA string `yaml:"ca"`
+
+	// The name to verify the certificate against, instead of the host
+	ServerName string `yaml:"server_name"`
+
+	// Skip verifying the certificate entirely
+	Insecure bool `yaml:"insecure"`
+}
+
+// NewTLSConfig returns the TLS configuration described by options, or nil
+// if there are none.
+func NewTLSConfig(options TLSOptions) (*tls.Config, error) {
+	if options == (TLSOptions{}) {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.Insecure}
+	if options.CA != "" {
+		pem, err := os.ReadFile(options.CA)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Failed to read CA certificates: %v", err))
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("No CA certificates found in %s", options.CA))
+		}
+	}
+	return config, nil
+}
+
+// tlsConfig returns the TLS configuration for checks that negotiate TLS
+// themselves, verifying the server's certificate against the destination's
+// host.
+func (dest *Destination) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+	if dest.TLSConfig != nil {
+		config = dest.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = dest.Host
+	}
+	return config
+}
+
+// InspectTLS reports on a negotiated TLS connection: the number of days
+// until the server's certificate expires is emitted as a gauge, and logged
+// as a warning if it's soon.
+func InspectTLS(dest *Destination, state tls.ConnectionState) {
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+	cert := state.PeerCertificates[0]
+	remaining := time.Until(cert.NotAfter)
+	days := int(remaining.Hours() / 24)
+
+	dest.Gauge("connectivity.tls.expiry_days", days, []string{fmt.Sprintf("tls_version:%s", EscapeTag(tls.VersionName(state.Version)))})
+	if remaining < CertificateExpiryWarning {
+		LogDestination(dest, fmt.Sprintf("TLS certificate for %s expires in %d days (%s)", cert.Subject, days, cert.NotAfter.Format(time.RFC3339)))
+	}
+}
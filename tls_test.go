@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTLSConfigs returns a server config with a certificate valid for
+// 127.0.0.1 and example.com, and a client config trusting it. The
+// certificate is borrowed from httptest.
+func testTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	return server.TLS.Clone(), server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+}
+
+// testTLSOptions returns tls options trusting the certificate served with
+// serverConfig, written to a CA file.
+func testTLSOptions(t *testing.T, serverConfig *tls.Config) TLSOptions {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverConfig.Certificates[0].Certificate[0]})
+	assertNoError(t, "WriteFile", os.WriteFile(path, cert, 0o600))
+	return TLSOptions{CA: path}
+}
+
+func TestDestinationTLSConfig(t *testing.T) {
+	dest, err := NewDestination(Url{Label: "smtp", Url: "smtp://mail.example.com"})
+	assertNoError(t, "NewDestination", err)
+	if got := dest.tlsConfig().ServerName; got != "mail.example.com" {
+		t.Errorf("ServerName = %q; want the destination's host", got)
+	}
+
+	dest, err = NewDestination(Url{Label: "smtp", Url: "smtp://mail.example.com", TLS: TLSOptions{ServerName: "relay.example.com", Insecure: true}})
+	assertNoError(t, "NewDestination", err)
+	if got := dest.tlsConfig(); got.ServerName != "relay.example.com" || !got.InsecureSkipVerify || got == dest.TLSConfig {
+		t.Errorf("tlsConfig() = %+v; want a copy of the destination's config", got)
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	config, err := NewTLSConfig(TLSOptions{})
+	if config != nil || err != nil {
+		t.Errorf("NewTLSConfig({}) = %v, %v; want nil, nil", config, err)
+	}
+
+	serverConfig, _ := testTLSConfigs(t)
+	config, err = NewTLSConfig(testTLSOptions(t, serverConfig))
+	assertNoError(t, "NewTLSConfig", err)
+	if config.RootCAs == nil || config.ServerName != "" || config.InsecureSkipVerify {
+		t.Errorf("NewTLSConfig = %+v; want only the CA certificates", config)
+	}
+
+	_, err = NewTLSConfig(TLSOptions{CA: filepath.Join(t.TempDir(), "missing.pem")})
+	assertErrorContains(t, err, "Failed to read CA certificates")
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	assertNoError(t, "WriteFile", os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	_, err = NewTLSConfig(TLSOptions{CA: notPEM})
+	assertErrorContains(t, err, "No CA certificates found")
+
+	_, err = NewDestination(Url{Label: "ldaps", Url: "ldaps://ldap.example.com", TLS: TLSOptions{CA: notPEM}})
+	assertErrorContains(t, err, "Invalid tls options")
+}
+
+func TestHTTPSTrustsConfiguredCA(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	dest, err := NewDestination(Url{Label: "https", Url: server.URL})
+	assertNoError(t, "NewDestination", err)
+	if HTTPS(dest) {
+		t.Errorf("HTTPS = true; want false for an untrusted certificate")
+	}
+	dest, err = NewDestination(Url{Label: "https", Url: server.URL, TLS: testTLSOptions(t, server.TLS)})
+	assertNoError(t, "NewDestination", err)
+	if !HTTPS(dest) {
+		t.Errorf("HTTPS = false; want true with the server's CA configured")
+	}
+}
+
+func TestInspectTLS(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	dest, err := NewDestination(Url{Label: "tls", Url: "https://example.com"})
+	assertNoError(t, "NewDestination", err)
+	cert := &x509.Certificate{NotAfter: time.Now().Add(10*24*time.Hour + time.Hour)}
+	InspectTLS(dest, tls.ConnectionState{Version: tls.VersionTLS13, PeerCertificates: []*x509.Certificate{cert}})
+
+	got := recvQueue(t)
+	if !strings.HasPrefix(got, "connectivity.tls.expiry_days:10|g") || !strings.Contains(got, "tls_version:TLS 1.3") {
+		t.Errorf("enqueued %q; want an expiry_days gauge of 10 tagged with the TLS version", got)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Long enough for a response to cross the internet, and for an ICMP port
+// unreachable message to come back.
+const DefaultUDPTimeout = 2 * time.Second
+
+// UDPProbe describes a payload for a udp:// destination to send, and what
+// the response must look like, as parsed from a URL such as:
+//
+//	udp://host:port?payload_hex=ff&expect=pong&timeout=1s
+type UDPProbe struct {
+	Payload []byte
+
+	// The response must start with Expect, match ExpectRegex, and be at least
+	// MinLength bytes long, for whichever of these are set. If none are set,
+	// no response is required, but the port must not be unreachable.
+	Expect      []byte
+	ExpectRegex *regexp.Regexp
+	MinLength   int
+
+	Timeout time.Duration
+}
+
+// ParseUDPProbe parses the query parameters of a udp:// URL, returning nil
+// if no payload is given.
+func ParseUDPProbe(u *url.URL) (*UDPProbe, error) {
+	query := u.Query()
+	probe := &UDPProbe{Timeout: DefaultUDPTimeout}
+
+	var err error
+	if probe.Payload, err = parsePayload(query, "payload"); err != nil {
+		return nil, err
+	}
+	if probe.Expect, err = parsePayload(query, "expect"); err != nil {
+		return nil, err
+	}
+	if pattern := query.Get("expect_regex"); pattern != "" {
+		if probe.ExpectRegex, err = regexp.Compile(pattern); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid expect_regex: %v", err))
+		}
+	}
+	if min := query.Get("min_length"); min != "" {
+		if probe.MinLength, err = strconv.Atoi(min); err != nil || probe.MinLength < 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid min_length: %s", min))
+		}
+	}
+	if timeout := query.Get("timeout"); timeout != "" {
+		if probe.Timeout, err = time.ParseDuration(timeout); err != nil || probe.Timeout <= 0 {
+			return nil, errors.New(fmt.Sprintf("Invalid timeout: %s", timeout))
+		}
+	}
+
+	if probe.Payload == nil {
+		if probe.Expect != nil || probe.ExpectRegex != nil || probe.MinLength > 0 {
+			return nil, errors.New("A payload (payload or payload_hex) is required to expect a response")
+		}
+		return nil, nil
+	}
+	return probe, nil
+}
+
+// parsePayload reads a parameter given either as a string (name) or as hex
+// (name_hex).
+func parsePayload(query url.Values, name string) ([]byte, error) {
+	if s := query.Get(name + "_hex"); s != "" {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid %s_hex: %v", name, err))
+		}
+		return b, nil
+	}
+	if s := query.Get(name); s != "" {
+		return []byte(s), nil
+	}
+	return nil, nil
+}
+
+// ExpectsResponse reports whether the probe requires a response at all.
+func (p *UDPProbe) ExpectsResponse() bool {
+	return p.Expect != nil || p.ExpectRegex != nil || p.MinLength > 0
+}
+
+// Evaluate returns an error describing the first way in which a response
+// does not meet expectations.
+func (p *UDPProbe) Evaluate(response []byte) error {
+	if len(response) < p.MinLength {
+		return errors.New(fmt.Sprintf("Response of %d bytes; want at least %d", len(response), p.MinLength))
+	}
+	if p.Expect != nil && !bytes.HasPrefix(response, p.Expect) {
+		return errors.New(fmt.Sprintf("Response %q does not start with %q", truncateBytes(response, 64), p.Expect))
+	}
+	if p.ExpectRegex != nil && !p.ExpectRegex.Match(response) {
+		return errors.New(fmt.Sprintf("Response %q does not match /%s/", truncateBytes(response, 64), p.ExpectRegex))
+	}
+	return nil
+}
+
+func truncateBytes(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
+
+// Sends the destination's payload to a specific IP, and validates the
+// response. Unlike dialing, which never sends anything over UDP, an ICMP port
+// unreachable response is detected and treated as a failure.
+func UDP(route *Route, dest *Destination, ip net.IP) bool {
+	metricTags := []string{fmt.Sprintf("dest_ip:%s", ip.String())}
+	hostPort := net.JoinHostPort(ip.String(), strconv.Itoa(dest.Port))
+
+	dest.Increment("connectivity.udp", metricTags)
+	response, took, err := dest.UDP.exchange(dest, hostPort)
+	if err == nil {
+		dest.Timer("connectivity.udp", took, metricTags)
+		err = dest.UDP.Evaluate(response)
+	}
+	if err != nil {
+		dest.Increment("connectivity.udp.error", metricTags)
+		LogRouteDestinationError(route, dest, fmt.Sprintf("Failed to probe %s", hostPort), err)
+		return false
+	}
+	dest.Increment("connectivity.udp.success", metricTags)
+	return true
+}
+
+// exchange sends the payload and waits for a response. If no response is
+// expected, waiting out the timeout without one is a success, since the only
+// way the port can refuse the payload is with an ICMP port unreachable.
+func (p *UDPProbe) exchange(dest *Destination, hostPort string) ([]byte, time.Duration, error) {
+	conn, err := dest.dial(context.Background(), "udp", hostPort)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.Timeout))
+
+	t1 := time.Now()
+	if _, err := conn.Write(p.Payload); err != nil {
+		return nil, 0, udpError(err)
+	}
+
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	took := time.Since(t1)
+	var netErr net.Error
+	if err != nil && errors.As(err, &netErr) && netErr.Timeout() && !p.ExpectsResponse() {
+		return nil, took, nil
+	} else if err != nil && errors.As(err, &netErr) && netErr.Timeout() {
+		return nil, took, errors.New(fmt.Sprintf("No response within %s", p.Timeout))
+	} else if err != nil {
+		return nil, took, udpError(err)
+	}
+	return buf[:n], took, nil
+}
+
+// udpError explains ICMP port unreachable messages, which are reported by
+// the kernel as a refused connection.
+func udpError(err error) error {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return errors.New(fmt.Sprintf("Port unreachable (ICMP): %v", err))
+	}
+	return err
+}
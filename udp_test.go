@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// newUDPServer answers each datagram using respond, or not at all if respond
+// returns nil.
+func newUDPServer(t *testing.T, respond func([]byte) []byte) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assertNoError(t, "ListenPacket", err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := respond(buf[:n]); response != nil {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// closedUDPPort returns a port with nothing listening on it, so that
+// datagrams sent to it are answered with ICMP port unreachable.
+func closedUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assertNoError(t, "ListenPacket", err)
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+	return port
+}
+
+func TestUDPUrlOptions(t *testing.T) {
+	got, err := NewDestination(Url{Label: "udp", Url: "udp://192.0.2.1:514"})
+	assertNoError(t, "udp:// without a payload", err)
+	if got.UDP != nil {
+		t.Errorf("UDP = %+v; want nil without a payload", got.UDP)
+	}
+
+	got, err = NewDestination(Url{Label: "udp", Url: "udp://192.0.2.1:27015?payload_hex=ffffffff54&expect_hex=ffffffff49&min_length=6&timeout=500ms"})
+	assertNoError(t, "udp:// with a hex payload", err)
+	if !bytes.Equal(got.UDP.Payload, []byte{0xff, 0xff, 0xff, 0xff, 0x54}) || !bytes.Equal(got.UDP.Expect, []byte{0xff, 0xff, 0xff, 0xff, 0x49}) || got.UDP.MinLength != 6 || got.UDP.Timeout.Milliseconds() != 500 {
+		t.Errorf("UDP = %+v; want the hex payload, expectation, min_length and timeout", got.UDP)
+	}
+
+	got, err = NewDestination(Url{Label: "udp", Url: "udp://192.0.2.1:7?payload=ping%0A&expect_regex=^pong"})
+	assertNoError(t, "udp:// with a string payload", err)
+	if string(got.UDP.Payload) != "ping\n" || got.UDP.ExpectRegex.String() != "^pong" || got.UDP.Timeout != DefaultUDPTimeout {
+		t.Errorf("UDP = %+v; want the string payload and regex", got.UDP)
+	}
+}
+
+func TestUDPUrlErrors(t *testing.T) {
+	cases := []struct {
+		url    string
+		substr string
+	}{
+		{url: "udp://192.0.2.1:7?payload_hex=zz", substr: "Invalid payload_hex"},
+		{url: "udp://192.0.2.1:7?payload=x&expect_hex=f", substr: "Invalid expect_hex"},
+		{url: "udp://192.0.2.1:7?payload=x&expect_regex=(", substr: "Invalid expect_regex"},
+		{url: "udp://192.0.2.1:7?payload=x&min_length=-1", substr: "Invalid min_length"},
+		{url: "udp://192.0.2.1:7?payload=x&timeout=soon", substr: "Invalid timeout"},
+		{url: "udp://192.0.2.1:7?expect=pong", substr: "payload"},
+	}
+	for _, tc := range cases {
+		_, err := NewDestination(Url{Label: "udp", Url: tc.url})
+		assertErrorContains(t, err, tc.substr)
+	}
+}
+
+func TestUDPProbe(t *testing.T) {
+	echo := newUDPServer(t, func(b []byte) []byte {
+		return append([]byte("pong "), b...)
+	})
+	silent := newUDPServer(t, func([]byte) []byte { return nil })
+	closed := closedUDPPort(t)
+
+	cases := []struct {
+		name  string
+		port  int
+		query string
+		want  bool
+	}{
+		{name: "prefix", port: echo, query: "payload=ping&expect=pong", want: true},
+		{name: "hex prefix", port: echo, query: "payload_hex=00ff&expect_hex=706f6e672000ff", want: true},
+		{name: "regex", port: echo, query: "payload=ping&expect_regex=^pong p.ng$", want: true},
+		{name: "min length", port: echo, query: "payload=ping&min_length=9", want: true},
+		{name: "any response", port: echo, query: "payload=ping", want: true},
+		{name: "wrong prefix", port: echo, query: "payload=ping&expect=PONG", want: false},
+		{name: "regex mismatch", port: echo, query: "payload=ping&expect_regex=^ping", want: false},
+		{name: "too short", port: echo, query: "payload=ping&min_length=10", want: false},
+		{name: "no response expected", port: silent, query: "payload=<14>hello&timeout=50ms", want: true},
+		{name: "no response", port: silent, query: "payload=ping&expect=pong&timeout=50ms", want: false},
+		{name: "port unreachable", port: closed, query: "payload=ping&timeout=500ms", want: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			u := fmt.Sprintf("udp://127.0.0.1:%d?%s", tc.port, strings.ReplaceAll(tc.query, " ", "%20"))
+			dest, err := NewDestination(Url{Label: "udp", Url: u})
+			assertNoError(t, u, err)
+			if got := UDP(nil, dest, net.ParseIP("127.0.0.1")); got != tc.want {
+				t.Errorf("UDP(%s) = %v; want %v", u, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUDPPortUnreachableError(t *testing.T) {
+	probe := &UDPProbe{Payload: []byte("ping"), Timeout: DefaultUDPTimeout}
+	_, _, err := probe.exchange(&Destination{}, fmt.Sprintf("127.0.0.1:%d", closedUDPPort(t)))
+	assertErrorContains(t, err, "Port unreachable (ICMP)")
+}
+
+func TestUDPProbeThroughCheck(t *testing.T) {
+	t.Cleanup(func() { drainQueue(t) })
+	drainQueue(t)
+
+	port := newUDPServer(t, func(b []byte) []byte { return []byte("ok") })
+	dest, err := NewDestination(Url{Label: "udp", Url: fmt.Sprintf("udp://127.0.0.1:%d?payload=hi&expect=ok", port)})
+	assertNoError(t, "NewDestination", err)
+	if !dest.Check() {
+		t.Errorf("Check(%s) = false; want true", dest.URL)
+	}
+}
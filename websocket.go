@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/*
+
+This module checks WebSocket endpoints, which can fail while plain requests
+to the same frontend succeed, such as when a proxy strips the Upgrade header.
+The check performs the opening handshake (RFC 6455), optionally exchanges a
+ping or a message, and then closes the connection cleanly. For example:
+
+	chat:
+	  url: wss://chat.example.com/socket
+	  websocket:
+	    send: '{"type":"hello"}'
+	    expect: '"type":"welcome"'
+
+*/
+
+const DefaultWebSocketTimeout = 10 * time.Second
+
+// The GUID the server appends to the client's key, per RFC 6455
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	wsText   = 0x1
+	wsBinary = 0x2
+	wsClose  = 0x8
+	wsPing   = 0x9
+	wsPong   = 0xA
+)
+
+// WebSocketOptions configure what a ws:// or wss:// destination exchanges
+// once connected.
+type WebSocketOptions struct {
+	// Send a ping frame, which must be answered with a pong
+	Ping bool `yaml:"ping"`
+
+	// Send a text message, which must be answered with a message
+	Send string `yaml:"send"`
+
+	// A regular expression that the message received must match
+	Expect string `yaml:"expect"`
+
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// WebSocketCheck is the compiled form of WebSocketOptions.
+type WebSocketCheck struct {
+	Ping    bool
+	Send    string
+	Expect  *regexp.Regexp
+	Timeout time.Duration
+}
+
+// IsWebSocket reports whether a scheme is checked by WebSocketCheck.
+func IsWebSocket(scheme string) bool {
+	return scheme == "ws" || scheme == "wss"
+}
+
+// IsZero reports whether no options were configured.
+func (o WebSocketOptions) IsZero() bool {
+	return o == WebSocketOptions{}
+}
+
+// NewWebSocketCheck validates a destination's WebSocket options.
+func NewWebSocketCheck(o WebSocketOptions) (*WebSocketCheck, error) {
+	check := &WebSocketCheck{Ping: o.Ping, Send: o.Send, Timeout: o.Timeout}
+	if o.Timeout < 0 {
+		return nil, errors.New("timeout must not be negative")
+	} else if o.Timeout == 0 {
+		check.Timeout = DefaultWebSocketTimeout
+	}
+	if o.Expect != "" {
+		if o.Send == "" {
+			return nil, errors.New("expect requires a message to send")
+		}
+		var err error
+		if check.Expect, err = regexp.Compile(o.Expect); err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid expect: %v", err))
+		}
+	}
+	return check, nil
+}
+
+// webSocketAccept returns the Sec-WebSocket-Accept value expected in response
+// to key.
+func webSocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// wsConn reads and writes WebSocket frames, as a client.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// writeFrame writes a single, final frame, masked as clients must.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else if len(payload) <= 0xffff {
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(len(payload)))
+	} else {
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(len(payload)))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// readFrame reads a frame, returning its opcode and payload. Fragmented
+// messages are returned a fragment at a time.
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	if length == 126 {
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	} else if length == 127 {
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if length > 1<<20 {
+		return 0, nil, errors.New(fmt.Sprintf("Frame of %d bytes is too large", length))
+	}
+
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(c.r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+// await reads frames until one with any of the given opcodes arrives,
+// answering pings along the way.
+func (c *wsConn) await(opcodes ...byte) (byte, []byte, error) {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, want := range opcodes {
+			if opcode == want {
+				return opcode, payload, nil
+			}
+		}
+		if opcode == wsClose {
+			return opcode, payload, errors.New(fmt.Sprintf("Server closed the connection%s", closeReason(payload)))
+		} else if opcode == wsPing {
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+}
+
+func closeReason(payload []byte) string {
+	if len(payload) < 2 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d %s)", binary.BigEndian.Uint16(payload), payload[2:])
+}
+
+// handshake sends the opening handshake and validates the server's response.
+func (c *wsConn) handshake(u *url.URL) error {
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	request := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery},
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {key},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+	if request.URL.Path == "" {
+		request.URL.Path = "/"
+	}
+	if err := request.Write(c.conn); err != nil {
+		return err
+	}
+
+	response, err := http.ReadResponse(c.r, request)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid handshake response: %v", err))
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		response.Body.Close()
+		return errors.New(fmt.Sprintf("Handshake failed with %s; expected 101 Switching Protocols", response.Status))
+	}
+	if !strings.EqualFold(response.Header.Get("Upgrade"), "websocket") {
+		return errors.New(fmt.Sprintf("Handshake response has Upgrade: %q; expected websocket", response.Header.Get("Upgrade")))
+	}
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != webSocketAccept(key) {
+		return errors.New(fmt.Sprintf("Handshake response has Sec-WebSocket-Accept: %q; expected %q", accept, webSocketAccept(key)))
+	}
+	return nil
+}
+
+// webSocketConversation connects to the destination, exchanges a ping or a
+// message as configured, and closes the connection, returning the message
+// received, if any.
+func webSocketConversation(dest *Destination) ([]byte, error) {
+	check := dest.WebSocket
+	ctx, cancel := context.WithTimeout(context.Background(), check.Timeout)
+	defer cancel()
+
+	u, err := url.Parse(dest.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dest.DialContext(ctx, "tcp", dest.HostPort())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { conn.Close() }()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if dest.Scheme == "wss" {
+		tlsConn := tls.Client(conn, dest.tlsConfig())
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, errors.New(fmt.Sprintf("TLS handshake failed: %v", err))
+		}
+		InspectTLS(dest, tlsConn.ConnectionState())
+		conn = tlsConn
+	}
+
+	c := &wsConn{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.handshake(u); err != nil {
+		return nil, err
+	}
+
+	if check.Ping {
+		payload := []byte("connectivity")
+		if err := c.writeFrame(wsPing, payload); err != nil {
+			return nil, err
+		}
+		if _, pong, err := c.await(wsPong); err != nil {
+			return nil, errors.New(fmt.Sprintf("No pong: %v", err))
+		} else if string(pong) != string(payload) {
+			return nil, errors.New(fmt.Sprintf("Pong has payload %q; expected %q", pong, payload))
+		}
+	}
+
+	var received []byte
+	if check.Send != "" {
+		if err := c.writeFrame(wsText, []byte(check.Send)); err != nil {
+			return nil, err
+		}
+		if _, received, err = c.await(wsText, wsBinary); err != nil {
+			return nil, errors.New(fmt.Sprintf("No message received: %v", err))
+		}
+		if check.Expect != nil && !check.Expect.Match(received) {
+			return received, errors.New(fmt.Sprintf("Message %q does not match /%s/", truncateBytes(received, 64), check.Expect))
+		}
+	}
+
+	// Close with 1000 (normal closure), and wait for the server to echo it
+	if err := c.writeFrame(wsClose, []byte{0x03, 0xe8}); err != nil {
+		return received, err
+	}
+	for {
+		opcode, _, err := c.readFrame()
+		if err != nil {
+			return received, errors.New(fmt.Sprintf("Connection closed without a close frame: %v", err))
+		}
+		if opcode == wsClose {
+			return received, nil
+		}
+	}
+}
+
+// Checks that the destination accepts WebSocket connections.
+func WebSocket(dest *Destination) bool {
+	dest.Increment("connectivity.websocket", []string{})
+	t1 := time.Now()
+	if _, err := webSocketConversation(dest); err != nil {
+		dest.Increment("connectivity.websocket.error", []string{})
+		LogDestinationError(dest, "Failed WebSocket check", err)
+		return false
+	}
+	dest.Timer("connectivity.websocket", time.Since(t1), []string{})
+	dest.Increment("connectivity.websocket.success", []string{})
+	return true
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newWebSocketServer echoes messages (prefixed with "echo: "), answers pings
+// and closes cleanly, unless behaviour says otherwise: "strip" responds as if
+// a proxy stripped the Upgrade header, "accept" responds with the wrong
+// Sec-WebSocket-Accept, and "drop" drops the connection instead of closing
+// cleanly. It returns the server's port and tls options trusting its
+// certificate.
+func newWebSocketServer(t *testing.T, behaviour string, useTLS bool) (int, TLSOptions) {
+	t.Helper()
+	return serveTest(t, useTLS, func(conn net.Conn, _ *tls.Config) {
+		r := bufio.NewReader(conn)
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		if behaviour == "strip" || !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+			fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 12\r\n\r\nHello, world")
+			return
+		}
+		accept := webSocketAccept(req.Header.Get("Sec-WebSocket-Key"))
+		if behaviour == "accept" {
+			accept = webSocketAccept("wrong")
+		}
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+
+		c := &wsConn{conn: conn, r: r}
+		write := func(opcode byte, payload []byte) {
+			conn.Write(append([]byte{0x80 | opcode, byte(len(payload))}, payload...))
+		}
+		for {
+			opcode, payload, err := c.readFrame()
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsPing:
+				write(wsPong, payload)
+			case wsText:
+				write(wsText, append([]byte("echo: "), payload...))
+			case wsClose:
+				if behaviour != "drop" {
+					write(wsClose, payload)
+				}
+				return
+			}
+		}
+	})
+}
+
+func TestNewWebSocketCheck(t *testing.T) {
+	check, err := NewWebSocketCheck(WebSocketOptions{Send: "hello", Expect: "^echo"})
+	assertNoError(t, "NewWebSocketCheck", err)
+	if check.Timeout != DefaultWebSocketTimeout || check.Expect.String() != "^echo" {
+		t.Errorf("NewWebSocketCheck = %+v; want the default timeout and a compiled expect", check)
+	}
+
+	_, err = NewWebSocketCheck(WebSocketOptions{Expect: "^echo"})
+	assertErrorContains(t, err, "expect requires a message to send")
+	_, err = NewWebSocketCheck(WebSocketOptions{Send: "hello", Expect: "("})
+	assertErrorContains(t, err, "Invalid expect")
+
+	_, err = NewDestination(Url{Label: "ws", Url: "https://example.com", WebSocket: WebSocketOptions{Ping: true}})
+	assertErrorContains(t, err, "only supported by ws:// and wss://")
+
+	dest, err := NewDestination(Url{Label: "wss", Url: "wss://example.com/socket"})
+	assertNoError(t, "NewDestination", err)
+	if dest.Port != 443 || dest.WebSocket == nil {
+		t.Errorf("wss:// port = %d, check = %v; want 443 and a WebSocket check", dest.Port, dest.WebSocket)
+	}
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	// The example from RFC 6455
+	if got := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("webSocketAccept = %q; want s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", got)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	cases := []struct {
+		name      string
+		behaviour string
+		tls       bool
+		opts      WebSocketOptions
+		want      string
+	}{
+		{name: "handshake"},
+		{name: "ping", opts: WebSocketOptions{Ping: true}},
+		{name: "message", opts: WebSocketOptions{Send: "hello", Expect: "^echo: hello$"}},
+		{name: "unexpected message", opts: WebSocketOptions{Send: "hello", Expect: "^welcome"}, want: `Message "echo: hello" does not match /^welcome/`},
+		{name: "tls", tls: true, opts: WebSocketOptions{Ping: true, Send: "hello"}},
+		{name: "upgrade stripped", behaviour: "strip", want: "Handshake failed with 200 OK"},
+		{name: "wrong accept", behaviour: "accept", want: "Sec-WebSocket-Accept"},
+		{name: "unclean close", behaviour: "drop", want: "Connection closed without a close frame"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() { drainQueue(t) })
+			drainQueue(t)
+			port, config := newWebSocketServer(t, tc.behaviour, tc.tls)
+			scheme := "ws"
+			if tc.tls {
+				scheme = "wss"
+			}
+			u := fmt.Sprintf("%s://127.0.0.1:%d/socket?room=1", scheme, port)
+			tc.opts.Timeout = 2 * time.Second
+			dest, err := NewDestination(Url{Label: "ws", Url: u, WebSocket: tc.opts, TLS: config})
+			assertNoError(t, "NewDestination", err)
+
+			_, err = webSocketConversation(dest)
+			if tc.want != "" {
+				assertErrorContains(t, err, tc.want)
+				if WebSocket(dest) {
+					t.Errorf("WebSocket = true; want false")
+				}
+				return
+			}
+			assertNoError(t, "webSocketConversation", err)
+			if !WebSocket(dest) {
+				t.Errorf("WebSocket = false; want true")
+			}
+		})
+	}
+}